@@ -0,0 +1,95 @@
+package serial
+
+// baudRates maps the standard CBAUD speed constants to their rates in bits per second.
+var baudRates = []struct {
+	rate uint32
+	flag CFlag
+}{
+	{0, B0},
+	{50, B50},
+	{75, B75},
+	{110, B110},
+	{134, B134},
+	{150, B150},
+	{200, B200},
+	{300, B300},
+	{600, B600},
+	{1200, B1200},
+	{1800, B1800},
+	{2400, B2400},
+	{4800, B4800},
+	{9600, B9600},
+	{19200, B19200},
+	{38400, B38400},
+	{57600, B57600},
+	{115200, B115200},
+	{230400, B230400},
+	{460800, B460800},
+	{500000, B500000},
+	{576000, B576000},
+	{921600, B921600},
+	{1000000, B1000000},
+	{1152000, B1152000},
+	{1500000, B1500000},
+	{2000000, B2000000},
+	{2500000, B2500000},
+	{3000000, B3000000},
+	{3500000, B3500000},
+	{4000000, B4000000},
+}
+
+// BaudToCFlag returns the CBAUD constant for the given rate in bits per second.
+// If there is no standard constant for the rate, BOTHER and false are returned
+// and the rate must be set through ISpeed/OSpeed, see Termios2.SetCustomSpeed.
+func BaudToCFlag(rate uint32) (CFlag, bool) {
+	for _, b := range baudRates {
+		if b.rate == rate {
+			return b.flag, true
+		}
+	}
+	return BOTHER, false
+}
+
+// CFlagToBaud returns the rate in bits per second of the CBAUD bits in flag.
+// False is returned for BOTHER, whose rate is held in ISpeed/OSpeed.
+func CFlagToBaud(flag CFlag) (uint32, bool) {
+	flag &= CBAUD
+	for _, b := range baudRates {
+		if b.flag == flag {
+			return b.rate, true
+		}
+	}
+	return 0, false
+}
+
+// Speed returns the output speed in bits per second, decoded from CBAUD
+// or from OSpeed when BOTHER is used.
+func (attrs *Termios2) Speed() uint32 {
+	if attrs.Cflag&CBAUD == BOTHER {
+		return attrs.OSpeed
+	}
+	rate, _ := CFlagToBaud(attrs.Cflag)
+	return rate
+}
+
+// InputSpeed returns the input speed in bits per second, decoded from CIBAUD
+// or from ISpeed when BOTHER is used.
+// When CIBAUD is zero the input speed equals the output speed.
+func (attrs *Termios2) InputSpeed() uint32 {
+	ibaud := (attrs.Cflag & CIBAUD) >> IBSHIFT
+	switch ibaud {
+	case B0:
+		return attrs.Speed()
+	case BOTHER:
+		return attrs.ISpeed
+	}
+	rate, _ := CFlagToBaud(ibaud)
+	return rate
+}
+
+// Speed returns the output speed in bits per second decoded from CBAUD.
+// Zero is returned for BOTHER, as Termios has no room for custom speeds; use Termios2.
+func (attrs *Termios) Speed() uint32 {
+	rate, _ := CFlagToBaud(attrs.Cflag)
+	return rate
+}
@@ -0,0 +1,47 @@
+package serial
+
+import "testing"
+
+func TestBaudMapping(t *testing.T) {
+	for _, b := range baudRates {
+		flag, ok := BaudToCFlag(b.rate)
+		if !ok || flag != b.flag {
+			t.Errorf("BaudToCFlag(%d) = %#o, %v", b.rate, flag, ok)
+		}
+		rate, ok := CFlagToBaud(b.flag | CS8 | CREAD)
+		if !ok || rate != b.rate {
+			t.Errorf("CFlagToBaud(%#o) = %d, %v", b.flag, rate, ok)
+		}
+	}
+	if flag, ok := BaudToCFlag(250000); ok || flag != BOTHER {
+		t.Errorf("BaudToCFlag(250000) = %#o, %v, want BOTHER, false", flag, ok)
+	}
+	if rate, ok := CFlagToBaud(BOTHER); ok {
+		t.Errorf("CFlagToBaud(BOTHER) = %d, true", rate)
+	}
+}
+
+func TestTermios2Speed(t *testing.T) {
+	tests := []struct {
+		attrs         Termios2
+		speed, ispeed uint32
+	}{
+		{Termios2{Cflag: B9600}, 9600, 9600},
+		{Termios2{Cflag: B115200 | B1200<<IBSHIFT}, 115200, 1200},
+		{Termios2{Cflag: BOTHER, ISpeed: 250000, OSpeed: 250000}, 250000, 250000},
+		{Termios2{Cflag: B9600 | BOTHER<<IBSHIFT, ISpeed: 31250}, 9600, 31250},
+		{Termios2{Cflag: BOTHER | B4800<<IBSHIFT, OSpeed: 100000}, 100000, 4800},
+	}
+	for _, tt := range tests {
+		if got := tt.attrs.Speed(); got != tt.speed {
+			t.Errorf("%#o: Speed() = %d, want %d", tt.attrs.Cflag, got, tt.speed)
+		}
+		if got := tt.attrs.InputSpeed(); got != tt.ispeed {
+			t.Errorf("%#o: InputSpeed() = %d, want %d", tt.attrs.Cflag, got, tt.ispeed)
+		}
+	}
+	attrs := &Termios{Cflag: B57600}
+	if got := attrs.Speed(); got != 57600 {
+		t.Errorf("Termios.Speed() = %d, want 57600", got)
+	}
+}
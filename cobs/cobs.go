@@ -0,0 +1,122 @@
+// Package cobs implements Consistent Overhead Byte Stuffing framing with 0x00 delimiters,
+// including the COBS/R variant, over an io.ReadWriter such as serial.Port.
+package cobs
+
+import (
+	"errors"
+)
+
+var (
+	// ErrCorrupt is returned for frames that are not valid COBS.
+	ErrCorrupt = errors.New("cobs: corrupted frame")
+	// ErrChecksum is returned for frames whose checksum trailer does not match.
+	ErrChecksum = errors.New("cobs: checksum mismatch")
+	// ErrPacketTooLong is returned for frames larger than the packet size limit.
+	ErrPacketTooLong = errors.New("cobs: packet too long")
+)
+
+// Encode appends the COBS encoding of src to dst, without the 0x00 delimiter.
+func Encode(dst, src []byte) []byte {
+	codeAt := len(dst)
+	dst = append(dst, 0)
+	code := byte(1)
+	for _, b := range src {
+		if b != 0 {
+			dst = append(dst, b)
+			code++
+			if code != 0xFF {
+				continue
+			}
+		}
+		dst[codeAt] = code
+		codeAt = len(dst)
+		dst = append(dst, 0)
+		code = 1
+	}
+	dst[codeAt] = code
+	return dst
+}
+
+// EncodeR appends the COBS/R encoding of src to dst, without the 0x00 delimiter.
+// COBS/R saves the final code byte when the last byte of src is larger than it.
+func EncodeR(dst, src []byte) []byte {
+	start := len(dst)
+	dst = Encode(dst, src)
+	// Find the code byte of the final block.
+	codeAt, code := start, 0
+	for i := start; i < len(dst); i += code {
+		codeAt, code = i, int(dst[i])
+	}
+	last := len(dst) - 1
+	if last > codeAt && dst[last] > dst[codeAt] {
+		dst[codeAt] = dst[last]
+		dst = dst[:last]
+	}
+	return dst
+}
+
+// Decode appends the decoding of the COBS frame src, without the 0x00 delimiter, to dst.
+func Decode(dst, src []byte) ([]byte, error) {
+	return decodeFrame(dst, src, false)
+}
+
+// DecodeR appends the decoding of the COBS/R frame src, without the 0x00 delimiter, to dst.
+func DecodeR(dst, src []byte) ([]byte, error) {
+	return decodeFrame(dst, src, true)
+}
+
+func decodeFrame(dst, src []byte, reduced bool) ([]byte, error) {
+	d := decoder{reduced: reduced, buf: dst}
+	for _, b := range src {
+		if err := d.add(b); err != nil {
+			return nil, err
+		}
+	}
+	return d.finish()
+}
+
+// decoder decodes a frame one byte at a time.
+type decoder struct {
+	reduced bool
+	buf     []byte
+	// code is the code byte of the current block, 0 before the first one.
+	code byte
+	// left is the number of data bytes remaining in the current block.
+	left int
+}
+
+func (d *decoder) reset(buf []byte) {
+	*d = decoder{reduced: d.reduced, buf: buf}
+}
+
+func (d *decoder) add(b byte) error {
+	if b == 0 {
+		return ErrCorrupt
+	}
+	if d.left > 0 {
+		d.buf = append(d.buf, b)
+		d.left--
+		return nil
+	}
+	// A block shorter than 254 bytes stands for its data followed by a zero.
+	if d.code != 0 && d.code != 0xFF {
+		d.buf = append(d.buf, 0)
+	}
+	d.code = b
+	d.left = int(b) - 1
+	return nil
+}
+
+func (d *decoder) finish() ([]byte, error) {
+	if d.code == 0 {
+		return nil, ErrCorrupt
+	}
+	if d.left > 0 {
+		// In COBS/R a short final block means its code byte is the last data byte.
+		if !d.reduced {
+			return nil, ErrCorrupt
+		}
+		d.buf = append(d.buf, d.code)
+	}
+	return d.buf, nil
+}
@@ -0,0 +1,117 @@
+package cobs
+
+import (
+	"bytes"
+	"testing"
+)
+
+var vectors = []struct {
+	data, cobs []byte
+}{
+	{[]byte{}, []byte{0x01}},
+	{[]byte{0x00}, []byte{0x01, 0x01}},
+	{[]byte{0x00, 0x00}, []byte{0x01, 0x01, 0x01}},
+	{[]byte{0x00, 0x11, 0x00}, []byte{0x01, 0x02, 0x11, 0x01}},
+	{[]byte{0x11, 0x22, 0x00, 0x33}, []byte{0x03, 0x11, 0x22, 0x02, 0x33}},
+	{[]byte{0x11, 0x22, 0x33, 0x44}, []byte{0x05, 0x11, 0x22, 0x33, 0x44}},
+	{[]byte{0x11, 0x00, 0x00, 0x00}, []byte{0x02, 0x11, 0x01, 0x01, 0x01}},
+}
+
+func TestEncode(t *testing.T) {
+	for _, v := range vectors {
+		if got := Encode(nil, v.data); !bytes.Equal(got, v.cobs) {
+			t.Errorf("Encode(% x): got % x, want % x", v.data, got, v.cobs)
+		}
+		if got, err := Decode(nil, v.cobs); err != nil || !bytes.Equal(got, v.data) {
+			t.Errorf("Decode(% x): got % x, %v, want % x", v.cobs, got, err, v.data)
+		}
+	}
+}
+
+func TestEncodeLongBlocks(t *testing.T) {
+	data := make([]byte, 254)
+	for i := range data {
+		data[i] = byte(i%255 + 1)
+	}
+	enc := Encode(nil, data)
+	if len(enc) != 256 || enc[0] != 0xFF || enc[255] != 0x01 {
+		t.Fatalf("254 non-zero bytes: got %d bytes, code %#x, last %#x", len(enc), enc[0], enc[len(enc)-1])
+	}
+	if dec, err := Decode(nil, enc); err != nil || !bytes.Equal(dec, data) {
+		t.Fatalf("round trip failed: %v", err)
+	}
+}
+
+func TestEncodeR(t *testing.T) {
+	// The last byte 0x06 is larger than the code 0x05 of the final block.
+	data := []byte{0x11, 0x22, 0x33, 0x06}
+	enc := EncodeR(nil, data)
+	if want := []byte{0x06, 0x11, 0x22, 0x33}; !bytes.Equal(enc, want) {
+		t.Fatalf("EncodeR: got % x, want % x", enc, want)
+	}
+	if dec, err := DecodeR(nil, enc); err != nil || !bytes.Equal(dec, data) {
+		t.Fatalf("DecodeR: got % x, %v", dec, err)
+	}
+	// Otherwise the encoding is plain COBS.
+	data = []byte{0x11, 0x22, 0x33, 0x05}
+	if enc := EncodeR(nil, data); !bytes.Equal(enc, Encode(nil, data)) {
+		t.Fatalf("EncodeR: got % x, want % x", enc, Encode(nil, data))
+	}
+}
+
+func TestDecodeCorrupt(t *testing.T) {
+	for _, frame := range [][]byte{
+		{},
+		{0x03, 0x11, 0x00, 0x22},
+		{0x05, 0x11, 0x22},
+	} {
+		if _, err := Decode(nil, frame); err != ErrCorrupt {
+			t.Errorf("Decode(% x): got %v, want ErrCorrupt", frame, err)
+		}
+	}
+}
+
+func addSeeds(f *testing.F) {
+	for _, v := range vectors {
+		f.Add(v.data)
+	}
+	f.Add(bytes.Repeat([]byte{0xAA}, 600))
+	f.Add(append(bytes.Repeat([]byte{0x01}, 254), 0x00, 0xFF))
+}
+
+func FuzzDecode(f *testing.F) {
+	addSeeds(f)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		enc := Encode(nil, data)
+		if bytes.IndexByte(enc, 0) >= 0 {
+			t.Fatalf("Encode(% x) contains a zero: % x", data, enc)
+		}
+		if max := len(data) + len(data)/254 + 1; len(enc) > max {
+			t.Fatalf("Encode(% x): %d bytes, more than %d", data, len(enc), max)
+		}
+		dec, err := Decode(nil, enc)
+		if err != nil || !bytes.Equal(dec, data) {
+			t.Fatalf("Decode(Encode(% x)): got % x, %v", data, dec, err)
+		}
+		// Arbitrary input must not panic.
+		Decode(nil, data)
+	})
+}
+
+func FuzzDecodeR(f *testing.F) {
+	addSeeds(f)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		enc := EncodeR(nil, data)
+		if bytes.IndexByte(enc, 0) >= 0 {
+			t.Fatalf("EncodeR(% x) contains a zero: % x", data, enc)
+		}
+		if plain := Encode(nil, data); len(enc) > len(plain) {
+			t.Fatalf("EncodeR(% x) is longer than Encode", data)
+		}
+		dec, err := DecodeR(nil, enc)
+		if err != nil || !bytes.Equal(dec, data) {
+			t.Fatalf("DecodeR(EncodeR(% x)): got % x, %v", data, dec, err)
+		}
+		DecodeR(nil, data)
+	})
+}
@@ -0,0 +1,181 @@
+package cobs
+
+import (
+	"bufio"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"sync"
+)
+
+// Checksum selects the checksum trailer appended to each packet before encoding.
+type Checksum int
+
+const (
+	ChecksumNone = Checksum(iota)
+	// ChecksumCRC16 is CRC-16/CCITT-FALSE, appended little endian.
+	ChecksumCRC16
+	// ChecksumCRC32 is the IEEE CRC-32 of hash/crc32, appended little endian.
+	ChecksumCRC32
+)
+
+// Size returns the length of the checksum trailer in bytes.
+func (c Checksum) Size() int {
+	switch c {
+	case ChecksumCRC16:
+		return 2
+	case ChecksumCRC32:
+		return 4
+	}
+	return 0
+}
+
+func (c Checksum) append(dst, data []byte) []byte {
+	switch c {
+	case ChecksumCRC16:
+		crc := CRC16(data)
+		return append(dst, byte(crc), byte(crc>>8))
+	case ChecksumCRC32:
+		crc := crc32.ChecksumIEEE(data)
+		return append(dst, byte(crc), byte(crc>>8), byte(crc>>16), byte(crc>>24))
+	}
+	return dst
+}
+
+// verify checks the trailer of packet and returns packet without it.
+func (c Checksum) verify(packet []byte) ([]byte, error) {
+	n := len(packet) - c.Size()
+	if n < 0 {
+		return nil, ErrChecksum
+	}
+	switch c {
+	case ChecksumCRC16:
+		if CRC16(packet[:n]) != binary.LittleEndian.Uint16(packet[n:]) {
+			return nil, ErrChecksum
+		}
+	case ChecksumCRC32:
+		if crc32.ChecksumIEEE(packet[:n]) != binary.LittleEndian.Uint32(packet[n:]) {
+			return nil, ErrChecksum
+		}
+	}
+	return packet[:n], nil
+}
+
+var crc16Table = func() (table [256]uint16) {
+	for i := range table {
+		crc := uint16(i) << 8
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+		table[i] = crc
+	}
+	return
+}()
+
+// CRC16 returns the CRC-16/CCITT-FALSE of data (polynomial 0x1021, initial value 0xFFFF).
+func CRC16(data []byte) uint16 {
+	crc := uint16(0xFFFF)
+	for _, b := range data {
+		crc = crc<<8 ^ crc16Table[byte(crc>>8)^b]
+	}
+	return crc
+}
+
+// DefaultMaxPacket is the packet size limit of a new Conn.
+const DefaultMaxPacket = 1024
+
+// Conn reads and writes COBS framed packets delimited by 0x00.
+//
+// Frames are decoded as they are read. A corrupted frame is reported by ReadPacket
+// after its delimiter has been consumed, so the next call resumes at the following frame.
+type Conn struct {
+	// MaxPacket is the largest packet ReadPacket accepts, not counting the checksum.
+	MaxPacket int
+	// Reduced selects the COBS/R variant.
+	Reduced bool
+	// Checksum is the trailer appended by WritePacket and verified by ReadPacket.
+	Checksum Checksum
+
+	r   *bufio.Reader
+	w   io.Writer
+	wmu sync.Mutex
+	d   decoder
+}
+
+// NewConn returns a Conn on rw using plain COBS without checksum,
+// with MaxPacket set to DefaultMaxPacket.
+func NewConn(rw io.ReadWriter) *Conn {
+	return &Conn{
+		MaxPacket: DefaultMaxPacket,
+		r:         bufio.NewReader(rw),
+		w:         rw,
+	}
+}
+
+// ReadPacket returns the next non-empty frame, decoded and with its checksum removed.
+// It returns io.EOF if the reader ends between frames and io.ErrUnexpectedEOF within one.
+// The returned slice is only valid until the next call to ReadPacket.
+func (c *Conn) ReadPacket() ([]byte, error) {
+	c.d.reduced = c.Reduced
+	c.d.reset(c.d.buf[:0])
+	limit := c.MaxPacket + c.Checksum.Size()
+	n := 0
+	var failed error
+	for {
+		b, err := c.r.ReadByte()
+		if err != nil {
+			if err == io.EOF && n > 0 {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		if b == 0 {
+			if n == 0 {
+				// Empty frames are used to flush the line.
+				continue
+			}
+			if failed != nil {
+				return nil, failed
+			}
+			packet, err := c.d.finish()
+			if err != nil {
+				return nil, err
+			}
+			if len(packet) > limit {
+				return nil, ErrPacketTooLong
+			}
+			return c.Checksum.verify(packet)
+		}
+		n++
+		if failed != nil {
+			continue
+		}
+		c.d.add(b)
+		if len(c.d.buf) > limit {
+			// Keep consuming until the delimiter, without growing the buffer.
+			failed = ErrPacketTooLong
+		}
+	}
+}
+
+// WritePacket appends the checksum to packet, encodes it and writes it
+// followed by the delimiter with a single Write.
+// It is safe to call from multiple goroutines.
+func (c *Conn) WritePacket(packet []byte) error {
+	data := c.Checksum.append(append(make([]byte, 0, len(packet)+4), packet...), packet)
+	frame := make([]byte, 0, len(data)+len(data)/254+2)
+	if c.Reduced {
+		frame = EncodeR(frame, data)
+	} else {
+		frame = Encode(frame, data)
+	}
+	frame = append(frame, 0)
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	_, err := c.w.Write(frame)
+	return err
+}
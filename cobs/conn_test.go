@@ -0,0 +1,92 @@
+package cobs
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestCRC16(t *testing.T) {
+	if crc := CRC16([]byte("123456789")); crc != 0x29B1 {
+		t.Fatalf("got %#04x, want 0x29b1", crc)
+	}
+}
+
+func TestConnRoundTrip(t *testing.T) {
+	packets := [][]byte{{0x00}, []byte("hello"), bytes.Repeat([]byte{0x00, 0xFF}, 300)}
+	for _, checksum := range []Checksum{ChecksumNone, ChecksumCRC16, ChecksumCRC32} {
+		for _, reduced := range []bool{false, true} {
+			var line bytes.Buffer
+			c := NewConn(&line)
+			c.Checksum = checksum
+			c.Reduced = reduced
+			for _, p := range packets {
+				if err := c.WritePacket(p); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for _, p := range packets {
+				got, err := c.ReadPacket()
+				if err != nil || !bytes.Equal(got, p) {
+					t.Fatalf("checksum %d, reduced %v: got % x, %v, want % x", checksum, reduced, got, err, p)
+				}
+			}
+			if _, err := c.ReadPacket(); err != io.EOF {
+				t.Fatalf("got %v, want io.EOF", err)
+			}
+		}
+	}
+}
+
+func TestConnResync(t *testing.T) {
+	var line bytes.Buffer
+	c := NewConn(&line)
+	c.MaxPacket = 8
+	c.WritePacket([]byte("one"))
+	// Noise, a truncated block and an oversized frame, each ended by a delimiter.
+	line.Write([]byte{0x00, 0x00, 0x05, 0x11, 0x22, 0x00})
+	line.Write(append(Encode(nil, bytes.Repeat([]byte{0x33}, 20)), 0x00))
+	c.WritePacket([]byte("two"))
+	// The line ends within a frame.
+	line.Write([]byte{0x04, 0x11})
+
+	for _, want := range []struct {
+		packet string
+		err    error
+	}{
+		{"one", nil},
+		{"", ErrCorrupt},
+		{"", ErrPacketTooLong},
+		{"two", nil},
+		{"", io.ErrUnexpectedEOF},
+	} {
+		got, err := c.ReadPacket()
+		if err != want.err || string(got) != want.packet {
+			t.Fatalf("got %q, %v, want %q, %v", got, err, want.packet, want.err)
+		}
+	}
+}
+
+func TestConnChecksumMismatch(t *testing.T) {
+	for _, checksum := range []Checksum{ChecksumCRC16, ChecksumCRC32} {
+		var line bytes.Buffer
+		c := NewConn(&line)
+		c.Checksum = checksum
+		c.WritePacket([]byte("corrupted"))
+		// Flip bits of a data byte without producing a zero.
+		line.Bytes()[3] ^= 0x01
+		c.WritePacket([]byte("intact"))
+		// A frame too short to hold the trailer.
+		line.Write([]byte{0x02, 0x41, 0x00})
+
+		if _, err := c.ReadPacket(); err != ErrChecksum {
+			t.Fatalf("checksum %d: got %v, want ErrChecksum", checksum, err)
+		}
+		if got, err := c.ReadPacket(); err != nil || string(got) != "intact" {
+			t.Fatalf("checksum %d: got %q, %v", checksum, got, err)
+		}
+		if _, err := c.ReadPacket(); err != ErrChecksum {
+			t.Fatalf("checksum %d: got %v, want ErrChecksum for a short frame", checksum, err)
+		}
+	}
+}
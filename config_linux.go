@@ -0,0 +1,227 @@
+package serial
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// Parity is the parity mode of a serial port.
+type Parity int
+
+const (
+	ParityNone = Parity(iota)
+	ParityOdd
+	ParityEven
+	// ParityMark always sets the parity bit (CMSPAR|PARODD).
+	ParityMark
+	// ParitySpace always clears the parity bit (CMSPAR).
+	ParitySpace
+)
+
+func (p Parity) String() string {
+	switch p {
+	case ParityNone:
+		return "None"
+	case ParityOdd:
+		return "Odd"
+	case ParityEven:
+		return "Even"
+	case ParityMark:
+		return "Mark"
+	case ParitySpace:
+		return "Space"
+	}
+	return fmt.Sprintf("Unknown(%d)", int(p))
+}
+
+// FlowControl is the flow control mode of a serial port.
+type FlowControl int
+
+const (
+	FlowNone = FlowControl(iota)
+	// FlowRTSCTS is hardware flow control (CRTSCTS).
+	FlowRTSCTS
+	// FlowXONXOFF is software flow control in both directions (IXON|IXOFF).
+	FlowXONXOFF
+)
+
+func (f FlowControl) String() string {
+	switch f {
+	case FlowNone:
+		return "None"
+	case FlowRTSCTS:
+		return "RTS/CTS"
+	case FlowXONXOFF:
+		return "XON/XOFF"
+	}
+	return fmt.Sprintf("Unknown(%d)", int(f))
+}
+
+// Config is a high level description of the serial port settings.
+type Config struct {
+	// BaudRate in bits per second. Non-standard rates are set through BOTHER.
+	BaudRate int
+	// DataBits per character, 5 to 8.
+	DataBits int
+	Parity   Parity
+	// StopBits per character, 1 or 2. 2 stop bits need 6 data bits or more,
+	// with 5 data bits UARTs send 1.5 stop bits instead.
+	StopBits    int
+	FlowControl FlowControl
+	// VMin is the minimum number of characters for a noncanonical read.
+	VMin uint8
+	// VTime is the timeout in deciseconds for a noncanonical read.
+	VTime uint8
+}
+
+// NewConfig returns a Config for the given baud rate with 8N1 framing,
+// no flow control, and reads returning as soon as one character is available.
+func NewConfig(baudRate int) *Config {
+	return &Config{
+		BaudRate: baudRate,
+		DataBits: 8,
+		Parity:   ParityNone,
+		StopBits: 1,
+		VMin:     1,
+	}
+}
+
+func configErr(format string, args ...interface{}) error {
+	return Error{fmt.Sprintf(format, args...), syscall.EINVAL}
+}
+
+// Validate returns an error describing the first invalid setting in the Config.
+// Returned errors match syscall.EINVAL.
+func (c *Config) Validate() error {
+	if c.BaudRate <= 0 || uint64(c.BaudRate) > 0xffffffff {
+		return configErr("invalid baud rate %d", c.BaudRate)
+	}
+	if c.DataBits < 5 || c.DataBits > 8 {
+		return configErr("invalid data bits %d, must be 5 to 8", c.DataBits)
+	}
+	if c.StopBits != 1 && c.StopBits != 2 {
+		return configErr("invalid stop bits %d, must be 1 or 2", c.StopBits)
+	}
+	if c.StopBits == 2 && c.DataBits == 5 {
+		return configErr("invalid stop bits 2 with 5 data bits, UARTs send 1.5 stop bits")
+	}
+	if c.Parity < ParityNone || c.Parity > ParitySpace {
+		return configErr("invalid parity %s", c.Parity)
+	}
+	if c.FlowControl < FlowNone || c.FlowControl > FlowXONXOFF {
+		return configErr("invalid flow control %s", c.FlowControl)
+	}
+	return nil
+}
+
+// Apply validates the Config and applies it to attrs.
+// Only the settings covered by the Config are changed.
+func (c *Config) Apply(attrs *Termios2) error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	attrs.Cflag &= ^(CSIZE | PARENB | PARODD | CMSPAR | CSTOPB | CRTSCTS | CIBAUD)
+	attrs.Cflag |= CREAD
+	attrs.Iflag &= ^(IXON | IXOFF | IXANY | INPCK)
+
+	if flag, ok := BaudToCFlag(uint32(c.BaudRate)); ok {
+		attrs.SetSpeed(flag)
+		attrs.ISpeed = uint32(c.BaudRate)
+		attrs.OSpeed = uint32(c.BaudRate)
+	} else {
+		attrs.SetCustomSpeed(uint32(c.BaudRate))
+	}
+
+	attrs.Cflag |= [...]CFlag{CS5, CS6, CS7, CS8}[c.DataBits-5]
+
+	switch c.Parity {
+	case ParityOdd:
+		attrs.Cflag |= PARENB | PARODD
+	case ParityEven:
+		attrs.Cflag |= PARENB
+	case ParityMark:
+		attrs.Cflag |= PARENB | PARODD | CMSPAR
+	case ParitySpace:
+		attrs.Cflag |= PARENB | CMSPAR
+	}
+	if c.Parity != ParityNone {
+		attrs.Iflag |= INPCK
+	}
+
+	if c.StopBits == 2 {
+		attrs.Cflag |= CSTOPB
+	}
+
+	switch c.FlowControl {
+	case FlowRTSCTS:
+		attrs.Cflag |= CRTSCTS
+	case FlowXONXOFF:
+		attrs.Iflag |= IXON | IXOFF
+	}
+
+	attrs.Cc[VMIN] = c.VMin
+	attrs.Cc[VTIME] = c.VTime
+	return nil
+}
+
+// ConfigFromTermios2 extracts the settings covered by Config from attrs.
+// If both hardware and software flow control are enabled, FlowRTSCTS is reported.
+// CSTOPB with CS5, meaning 1.5 stop bits, is reported as 2 stop bits and fails Validate.
+func ConfigFromTermios2(attrs *Termios2) *Config {
+	c := &Config{
+		BaudRate: int(attrs.Speed()),
+		DataBits: 5 + int((attrs.Cflag&CSIZE)>>4),
+		StopBits: 1,
+		VMin:     attrs.Cc[VMIN],
+		VTime:    attrs.Cc[VTIME],
+	}
+	if attrs.Cflag&PARENB != 0 {
+		switch attrs.Cflag & (PARODD | CMSPAR) {
+		case PARODD | CMSPAR:
+			c.Parity = ParityMark
+		case CMSPAR:
+			c.Parity = ParitySpace
+		case PARODD:
+			c.Parity = ParityOdd
+		default:
+			c.Parity = ParityEven
+		}
+	}
+	if attrs.Cflag&CSTOPB != 0 {
+		c.StopBits = 2
+	}
+	if attrs.Cflag&CRTSCTS != 0 {
+		c.FlowControl = FlowRTSCTS
+	} else if attrs.Iflag&(IXON|IXOFF) != 0 {
+		c.FlowControl = FlowXONXOFF
+	}
+	return c
+}
+
+// Configure applies cfg to the Port using GetAttr2 and SetAttr2.
+// Settings not covered by Config are left untouched.
+// If the settings cannot be applied, the previous ones are restored.
+func (p *Port) Configure(cfg *Config) error {
+	attrs, err := p.GetAttr2()
+	if err != nil {
+		return wrapErr("Configure", err)
+	}
+	prev := *attrs
+	if err := cfg.Apply(attrs); err != nil {
+		return wrapErr("Configure", err)
+	}
+	if err := p.SetAttr2(TCSANOW, attrs); err != nil {
+		p.SetAttr2(TCSANOW, &prev)
+		return wrapErr("Configure", err)
+	}
+	return nil
+}
+
+// Config returns the current settings of the Port as a Config.
+func (p *Port) Config() (*Config, error) {
+	attrs, err := p.GetAttr2()
+	if err != nil {
+		return nil, wrapErr("Config", err)
+	}
+	return ConfigFromTermios2(attrs), nil
+}
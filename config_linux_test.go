@@ -0,0 +1,92 @@
+package serial
+
+import (
+	"errors"
+	"syscall"
+	"testing"
+)
+
+func TestConfigValidate(t *testing.T) {
+	valid := []*Config{
+		NewConfig(9600),
+		{BaudRate: 250000, DataBits: 7, Parity: ParityEven, StopBits: 2, FlowControl: FlowRTSCTS},
+		{BaudRate: 300, DataBits: 5, Parity: ParityMark, StopBits: 1, FlowControl: FlowXONXOFF},
+	}
+	for _, c := range valid {
+		if err := c.Validate(); err != nil {
+			t.Errorf("%+v: %v", c, err)
+		}
+	}
+	invalid := []*Config{
+		{BaudRate: 0, DataBits: 8, StopBits: 1},
+		{BaudRate: -9600, DataBits: 8, StopBits: 1},
+		{BaudRate: 9600, DataBits: 4, StopBits: 1},
+		{BaudRate: 9600, DataBits: 9, StopBits: 1},
+		{BaudRate: 9600, DataBits: 8, StopBits: 0},
+		{BaudRate: 9600, DataBits: 8, StopBits: 3},
+		{BaudRate: 9600, DataBits: 5, StopBits: 2},
+		{BaudRate: 9600, DataBits: 8, StopBits: 1, Parity: ParitySpace + 1},
+		{BaudRate: 9600, DataBits: 8, StopBits: 1, FlowControl: -1},
+	}
+	for _, c := range invalid {
+		err := c.Validate()
+		if !errors.Is(err, syscall.EINVAL) {
+			t.Errorf("%+v: got %v, want EINVAL", c, err)
+		}
+		attrs := &Termios2{}
+		if err := c.Apply(attrs); err == nil || *attrs != (Termios2{}) {
+			t.Errorf("%+v: Apply accepted or changed attrs", c)
+		}
+	}
+}
+
+func TestConfigRoundTrip(t *testing.T) {
+	configs := []*Config{
+		NewConfig(115200),
+		{BaudRate: 9600, DataBits: 7, Parity: ParityEven, StopBits: 2, FlowControl: FlowXONXOFF, VMin: 0, VTime: 5},
+		{BaudRate: 250000, DataBits: 8, Parity: ParityOdd, StopBits: 1, FlowControl: FlowRTSCTS, VMin: 4},
+		{BaudRate: 1200, DataBits: 5, Parity: ParityMark, StopBits: 1},
+		{BaudRate: 4000000, DataBits: 6, Parity: ParitySpace, StopBits: 2},
+	}
+	for _, c := range configs {
+		// Start from settings the Config has to clear.
+		attrs := &Termios2{Cflag: CS8 | PARENB | CSTOPB | CRTSCTS | B38400, Iflag: IXON | IXOFF | IGNBRK}
+		if err := c.Apply(attrs); err != nil {
+			t.Fatalf("%+v: %v", c, err)
+		}
+		if attrs.Iflag&IGNBRK == 0 {
+			t.Errorf("%+v: Apply cleared IGNBRK", c)
+		}
+		if got := ConfigFromTermios2(attrs); *got != *c {
+			t.Errorf("got %+v, want %+v", got, c)
+		}
+	}
+}
+
+func TestPortConfigure(t *testing.T) {
+	master, slave, err := OpenPTY(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer master.Close()
+	defer slave.Close()
+
+	// Ptys force CS8 without parity, the other settings are kept.
+	c := &Config{BaudRate: 250000, DataBits: 8, StopBits: 2, FlowControl: FlowRTSCTS, VMin: 1, VTime: 2}
+	if err := slave.Configure(c); err != nil {
+		t.Fatal(err)
+	}
+	got, err := slave.Config()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *got != *c {
+		t.Fatalf("got %+v, want %+v", got, c)
+	}
+	if err := slave.Configure(&Config{BaudRate: 9600, DataBits: 5, StopBits: 2}); !errors.Is(err, syscall.EINVAL) {
+		t.Fatalf("Configure: got %v, want EINVAL", err)
+	}
+	if got, _ := slave.Config(); *got != *c {
+		t.Fatalf("settings changed by a rejected Config: %+v", got)
+	}
+}
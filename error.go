@@ -1,6 +1,11 @@
 package serial
 
-import "syscall"
+import (
+	"errors"
+	"github.com/daedaluz/fdev/poll"
+	"os"
+	"syscall"
+)
 
 type Error struct {
 	msg string
@@ -25,6 +30,30 @@ func (e Error) Unwrap() error {
 	return e.err
 }
 
+// Timeout reports whether the error is caused by an expired deadline or read timeout.
+// Together with Temporary it makes Error satisfy net.Error.
+func (e Error) Timeout() bool {
+	var t interface{ Timeout() bool }
+	return errors.As(e.err, &t) && t.Timeout()
+}
+
+// Temporary reports whether the error is temporary, which is only true for timeouts.
+func (e Error) Temporary() bool {
+	return e.Timeout()
+}
+
+// timeoutError is the cause of ErrTimeout.
+// It matches both os.ErrDeadlineExceeded and poll.ErrTimeout.
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func (timeoutError) Is(target error) bool {
+	return target == os.ErrDeadlineExceeded || target == poll.ErrTimeout
+}
+
 func wrapErr(msg string, e error) error {
 	if e == nil {
 		return nil
@@ -36,5 +65,7 @@ func wrapErr(msg string, e error) error {
 }
 
 var (
-	ErrClosed = Error{"port already closed", syscall.EBADF}
+	ErrClosed  = Error{"port already closed", syscall.EBADF}
+	ErrTimeout = Error{"", timeoutError{}}
+	ErrLocked  = Error{"port locked", syscall.EBUSY}
 )
@@ -1,6 +1,6 @@
 module github.com/daedaluz/goserial
 
-go 1.17
+go 1.18
 
 require github.com/daedaluz/goioctl v0.0.0-20211206100409-83a7ad26457f
 
@@ -0,0 +1,226 @@
+// Package hdlc implements the asynchronous HDLC-like framing of RFC 1662,
+// as used by PPP, over an io.ReadWriter such as serial.Port.
+package hdlc
+
+import (
+	"bufio"
+	"hash/crc32"
+	"io"
+	"sync"
+)
+
+const (
+	// Flag delimits frames.
+	Flag = byte(0x7E)
+	// Escape precedes an escaped byte, which is sent XORed with 0x20.
+	Escape = byte(0x7D)
+
+	escapeXOR = byte(0x20)
+)
+
+// FCS selects the frame check sequence.
+type FCS int
+
+const (
+	// FCS16 is the 16 bit FCS of RFC 1662, sent least significant byte first.
+	FCS16 = FCS(iota)
+	// FCS32 is the 32 bit FCS of RFC 1662, sent least significant byte first.
+	FCS32
+)
+
+// Size returns the length of the FCS in bytes.
+func (f FCS) Size() int {
+	if f == FCS32 {
+		return 4
+	}
+	return 2
+}
+
+func (f FCS) append(dst, data []byte) []byte {
+	if f == FCS32 {
+		fcs := crc32.ChecksumIEEE(data)
+		return append(dst, byte(fcs), byte(fcs>>8), byte(fcs>>16), byte(fcs>>24))
+	}
+	fcs := FCS16Checksum(data)
+	return append(dst, byte(fcs), byte(fcs>>8))
+}
+
+var fcs16Table = func() (table [256]uint16) {
+	for i := range table {
+		fcs := uint16(i)
+		for j := 0; j < 8; j++ {
+			if fcs&1 != 0 {
+				fcs = fcs>>1 ^ 0x8408
+			} else {
+				fcs >>= 1
+			}
+		}
+		table[i] = fcs
+	}
+	return
+}()
+
+// FCS16Checksum returns the 16 bit FCS of data, already complemented for transmission.
+func FCS16Checksum(data []byte) uint16 {
+	fcs := uint16(0xFFFF)
+	for _, b := range data {
+		fcs = fcs>>8 ^ fcs16Table[byte(fcs)^b]
+	}
+	return ^fcs
+}
+
+// DefaultMaxFrame is the frame size limit of a new Conn, the default PPP MRU of 1500
+// plus address, control and protocol fields.
+const DefaultMaxFrame = 1504
+
+// DefaultACCM escapes all control characters, as RFC 1662 requires until negotiated otherwise.
+const DefaultACCM = uint32(0xFFFFFFFF)
+
+// Stats counts frames handled by a Conn.
+type Stats struct {
+	// Received and Sent count good frames.
+	Received uint64
+	Sent     uint64
+	// Dropped counts frames that were aborted, too short or larger than MaxFrame.
+	Dropped uint64
+	// BadFCS counts frames whose FCS did not match.
+	BadFCS uint64
+}
+
+// Conn reads and writes HDLC-like frames.
+type Conn struct {
+	// SendACCM is the async control character map for sending:
+	// control character n is escaped if bit n is set. Flag and Escape are always escaped.
+	SendACCM uint32
+	// RecvACCM is the async control character map for receiving:
+	// unescaped control character n is discarded if bit n is set,
+	// as it may have been inserted by intermediate equipment.
+	RecvACCM uint32
+	FCS      FCS
+	// MaxFrame is the largest frame ReadFrame accepts, not counting the FCS.
+	MaxFrame int
+
+	r     *bufio.Reader
+	w     io.Writer
+	wmu   sync.Mutex
+	buf   []byte
+	smu   sync.Mutex
+	stats Stats
+}
+
+// NewConn returns a Conn on rw using FCS16, DefaultACCM in both directions and DefaultMaxFrame.
+func NewConn(rw io.ReadWriter) *Conn {
+	return &Conn{
+		SendACCM: DefaultACCM,
+		RecvACCM: DefaultACCM,
+		FCS:      FCS16,
+		MaxFrame: DefaultMaxFrame,
+		r:        bufio.NewReader(rw),
+		w:        rw,
+	}
+}
+
+// Stats returns a snapshot of the frame counters.
+func (c *Conn) Stats() Stats {
+	c.smu.Lock()
+	defer c.smu.Unlock()
+	return c.stats
+}
+
+func (c *Conn) count(counter *uint64) {
+	c.smu.Lock()
+	*counter++
+	c.smu.Unlock()
+}
+
+// ReadFrame returns the next good frame without its FCS.
+// Bad frames are discarded silently and counted in Stats.
+// It returns io.EOF if the reader ends between frames and io.ErrUnexpectedEOF within one.
+// The returned slice is only valid until the next call to ReadFrame.
+func (c *Conn) ReadFrame() ([]byte, error) {
+	c.buf = c.buf[:0]
+	escaped := false
+	dropped := false
+	limit := c.MaxFrame + c.FCS.Size()
+	for {
+		b, err := c.r.ReadByte()
+		if err != nil {
+			if err == io.EOF && (len(c.buf) > 0 || escaped || dropped) {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		switch {
+		case b == Flag:
+			if escaped || dropped {
+				// Escape followed by Flag aborts the frame.
+				c.count(&c.stats.Dropped)
+			} else if len(c.buf) > 0 {
+				if frame, ok := c.check(c.buf); ok {
+					return frame, nil
+				}
+			}
+			c.buf = c.buf[:0]
+			escaped, dropped = false, false
+			continue
+		case b < 0x20 && c.RecvACCM&(1<<b) != 0:
+			continue
+		case b == Escape:
+			escaped = true
+			continue
+		case escaped:
+			b ^= escapeXOR
+			escaped = false
+		}
+		if dropped {
+			continue
+		}
+		if len(c.buf) >= limit {
+			dropped = true
+			continue
+		}
+		c.buf = append(c.buf, b)
+	}
+}
+
+// check verifies the FCS of a complete frame and returns the frame without it.
+func (c *Conn) check(frame []byte) ([]byte, bool) {
+	n := len(frame) - c.FCS.Size()
+	if n < 1 {
+		c.count(&c.stats.Dropped)
+		return nil, false
+	}
+	fcs := c.FCS.append(nil, frame[:n])
+	for i := range fcs {
+		if fcs[i] != frame[n+i] {
+			c.count(&c.stats.BadFCS)
+			return nil, false
+		}
+	}
+	c.count(&c.stats.Received)
+	return frame[:n], true
+}
+
+// WriteFrame appends the FCS to data, escapes it and writes it between
+// two flags with a single Write.
+// It is safe to call from multiple goroutines.
+func (c *Conn) WriteFrame(data []byte) error {
+	raw := c.FCS.append(append(make([]byte, 0, len(data)+4), data...), data)
+	frame := make([]byte, 0, 2*len(raw)+2)
+	frame = append(frame, Flag)
+	for _, b := range raw {
+		if b == Flag || b == Escape || b < 0x20 && c.SendACCM&(1<<b) != 0 {
+			frame = append(frame, Escape, b^escapeXOR)
+		} else {
+			frame = append(frame, b)
+		}
+	}
+	frame = append(frame, Flag)
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if _, err := c.w.Write(frame); err != nil {
+		return err
+	}
+	c.count(&c.stats.Sent)
+	return nil
+}
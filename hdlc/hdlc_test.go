@@ -0,0 +1,136 @@
+package hdlc
+
+import (
+	"bytes"
+	"github.com/daedaluz/goserial/internal/ptytest"
+	"io"
+	"testing"
+)
+
+func TestFCS(t *testing.T) {
+	data := []byte("123456789")
+	if fcs := FCS16Checksum(data); fcs != 0x906E {
+		t.Fatalf("FCS16Checksum: got %#04x, want 0x906e", fcs)
+	}
+	if got := FCS32.append(nil, data); !bytes.Equal(got, []byte{0x26, 0x39, 0xF4, 0xCB}) {
+		t.Fatalf("FCS32: got % x", got)
+	}
+	// Running the FCS over a frame including its FCS leaves the good FCS of RFC 1662.
+	if fcs := ^FCS16Checksum(FCS16.append(data, data)); fcs != 0xF0B8 {
+		t.Fatalf("FCS16 residue: got %#04x, want 0xf0b8", fcs)
+	}
+}
+
+func allBytes() []byte {
+	data := make([]byte, 256)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	return data
+}
+
+func TestConnRoundTrip(t *testing.T) {
+	frames := [][]byte{{Flag}, {Escape}, allBytes(), []byte("hello")}
+	for _, fcs := range []FCS{FCS16, FCS32} {
+		for _, accm := range []uint32{DefaultACCM, 0} {
+			var line bytes.Buffer
+			c := NewConn(&line)
+			c.FCS = fcs
+			c.SendACCM, c.RecvACCM = accm, accm
+			for _, f := range frames {
+				if err := c.WriteFrame(f); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for _, f := range frames {
+				got, err := c.ReadFrame()
+				if err != nil || !bytes.Equal(got, f) {
+					t.Fatalf("FCS %d, ACCM %#x: got % x, %v, want % x", fcs, accm, got, err, f)
+				}
+			}
+			if _, err := c.ReadFrame(); err != io.EOF {
+				t.Fatalf("got %v, want io.EOF", err)
+			}
+			if s := c.Stats(); s.Sent != 4 || s.Received != 4 || s.Dropped != 0 || s.BadFCS != 0 {
+				t.Fatalf("Stats: %+v", s)
+			}
+		}
+	}
+}
+
+func TestSendACCM(t *testing.T) {
+	var line bytes.Buffer
+	c := NewConn(&line)
+	// Escape XON and XOFF only.
+	c.SendACCM = 1<<0x11 | 1<<0x13
+	c.WriteFrame([]byte{0x00, 0x11, 0x13, 0x1F, 0x20, Flag, Escape})
+	want := []byte{Flag, 0x00, Escape, 0x31, Escape, 0x33, 0x1F, 0x20, Escape, 0x5E, Escape, 0x5D}
+	if got := line.Bytes(); !bytes.Equal(got[:len(want)], want) {
+		t.Fatalf("got % x, want % x", got[:len(want)], want)
+	}
+}
+
+func TestRecvACCM(t *testing.T) {
+	var line bytes.Buffer
+	sender := NewConn(&line)
+	sender.WriteFrame([]byte("data"))
+	frame := line.Bytes()
+	// Control characters inserted by the link, some of which the receiver maps out.
+	line = *bytes.NewBuffer(append([]byte{Flag, 'd', 0x11, 'a', 0x13}, frame[3:]...))
+	c := NewConn(&line)
+	c.RecvACCM = 1<<0x11 | 1<<0x13
+	if got, err := c.ReadFrame(); err != nil || string(got) != "data" {
+		t.Fatalf("got %q, %v", got, err)
+	}
+
+	// Escaped control characters are data even if mapped.
+	line.Reset()
+	sender.WriteFrame([]byte{0x11})
+	if got, err := c.ReadFrame(); err != nil || !bytes.Equal(got, []byte{0x11}) {
+		t.Fatalf("got % x, %v", got, err)
+	}
+}
+
+func TestConnBadFrames(t *testing.T) {
+	var line bytes.Buffer
+	c := NewConn(&line)
+	c.MaxFrame = 8
+	c.WriteFrame([]byte("one"))
+	// An aborted frame.
+	line.Write([]byte{Flag, 'a', 'b', Escape, Flag})
+	// A frame with a corrupted FCS.
+	c.WriteFrame([]byte("bad"))
+	line.Bytes()[line.Len()-3] ^= 0x01
+	// A frame shorter than its FCS and one larger than MaxFrame.
+	line.Write([]byte{Flag, 'z', Flag})
+	c.WriteFrame(bytes.Repeat([]byte{'x'}, 20))
+	c.WriteFrame([]byte("two"))
+	// The line ends within a frame.
+	line.Write([]byte{Flag, 'c'})
+
+	for _, want := range []string{"one", "two"} {
+		got, err := c.ReadFrame()
+		if err != nil || string(got) != want {
+			t.Fatalf("got %q, %v, want %q", got, err, want)
+		}
+	}
+	if _, err := c.ReadFrame(); err != io.ErrUnexpectedEOF {
+		t.Fatalf("got %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+	want := Stats{Received: 2, Sent: 4, Dropped: 3, BadFCS: 1}
+	if s := c.Stats(); s != want {
+		t.Fatalf("Stats: got %+v, want %+v", s, want)
+	}
+}
+
+func TestConnOverPTY(t *testing.T) {
+	master, slave := ptytest.Pair(t)
+	sender, receiver := NewConn(master), NewConn(slave)
+	sender.FCS, receiver.FCS = FCS32, FCS32
+	data := bytes.Repeat(allBytes(), 4)
+	go sender.WriteFrame(data)
+	got, err := receiver.ReadFrame()
+	if err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("got %d bytes, %v", len(got), err)
+	}
+}
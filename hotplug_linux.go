@@ -0,0 +1,310 @@
+package serial
+
+import (
+	"bytes"
+	"errors"
+	"github.com/daedaluz/fdev/poll"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+)
+
+// HotplugAction tells whether a port was added or removed.
+type HotplugAction int
+
+const (
+	PortAdded = HotplugAction(iota + 1)
+	PortRemoved
+)
+
+func (a HotplugAction) String() string {
+	switch a {
+	case PortAdded:
+		return "Added"
+	case PortRemoved:
+		return "Removed"
+	}
+	return "Unknown"
+}
+
+// HotplugEvent is emitted by a Watcher when a serial port appears or disappears.
+type HotplugEvent struct {
+	Action HotplugAction
+	// Port describes the port. For removed ports this is the information
+	// gathered when the port was last seen, as sysfs is already gone.
+	// The ByID and ByPath links of added ports are created by udev after the
+	// kernel event, so they are usually empty; list the ports again to get them.
+	Port *PortInfo
+}
+
+// UeventSource delivers raw kernel uevent messages, one per call.
+// ReadUevent returns an error matching syscall.ENOBUFS when messages were lost,
+// the Watcher then rescans the ports and keeps reading.
+// Close must unblock a pending ReadUevent.
+type UeventSource interface {
+	ReadUevent() ([]byte, error)
+	Close() error
+}
+
+// ueventBufferSize is the receive buffer requested for the uevent socket,
+// large enough for the burst of events of a hub full of adapters being plugged in.
+const ueventBufferSize = 1 << 20
+
+// ueventSocket is a NETLINK_KOBJECT_UEVENT socket subscribed to kernel events.
+type ueventSocket struct {
+	mu      sync.Mutex
+	fd      int
+	wake    [2]int
+	closing int32
+	closed  bool
+	buf     []byte
+}
+
+// OpenUeventSocket returns an UeventSource reading kernel uevents from netlink.
+func OpenUeventSocket() (UeventSource, error) {
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_RAW|syscall.SOCK_CLOEXEC, syscall.NETLINK_KOBJECT_UEVENT)
+	if err != nil {
+		return nil, wrapErr("OpenUeventSocket", err)
+	}
+	// Group 1 carries the kernel events, as opposed to the ones rebroadcast by udev.
+	if err := syscall.Bind(fd, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK, Groups: 1}); err != nil {
+		syscall.Close(fd)
+		return nil, wrapErr("OpenUeventSocket", err)
+	}
+	// Best effort, overruns are recovered from by rescanning.
+	syscall.SetsockoptInt(fd, syscall.SOL_SOCKET, syscall.SO_RCVBUF, ueventBufferSize)
+	s := &ueventSocket{fd: fd, buf: make([]byte, 16384)}
+	if err := syscall.Pipe2(s.wake[:], syscall.O_CLOEXEC|syscall.O_NONBLOCK); err != nil {
+		syscall.Close(fd)
+		return nil, wrapErr("OpenUeventSocket", err)
+	}
+	return s, nil
+}
+
+func (s *ueventSocket) ReadUevent() ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil, ErrClosed
+	}
+	for {
+		fds := []poll.PollFd{
+			{Fd: int32(s.fd), Events: poll.POLLIN},
+			{Fd: int32(s.wake[0]), Events: poll.POLLIN},
+		}
+		if _, err := poll.Poll(fds, -1); err != nil {
+			return nil, wrapErr("ReadUevent", err)
+		}
+		if fds[1].REvents != 0 {
+			return nil, ErrClosed
+		}
+		if fds[0].REvents == 0 {
+			continue
+		}
+		n, from, err := syscall.Recvfrom(s.fd, s.buf, syscall.MSG_DONTWAIT)
+		if err == syscall.EAGAIN || err == syscall.EINTR {
+			continue
+		}
+		if err != nil {
+			return nil, wrapErr("ReadUevent", err)
+		}
+		// Only trust messages sent by the kernel.
+		if sa, ok := from.(*syscall.SockaddrNetlink); !ok || sa.Pid != 0 {
+			continue
+		}
+		msg := make([]byte, n)
+		copy(msg, s.buf[:n])
+		return msg, nil
+	}
+}
+
+func (s *ueventSocket) Close() error {
+	if !atomic.CompareAndSwapInt32(&s.closing, 0, 1) {
+		return ErrClosed
+	}
+	// Wake a pending ReadUevent, then wait for it to release the lock.
+	syscall.Write(s.wake[1], []byte{0})
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	syscall.Close(s.wake[0])
+	syscall.Close(s.wake[1])
+	return wrapErr("Close", syscall.Close(s.fd))
+}
+
+// Watcher reports serial ports being added to or removed from the system.
+type Watcher struct {
+	src    UeventSource
+	root   string
+	known  map[string]*PortInfo
+	events chan HotplugEvent
+	quit   chan struct{}
+	done   chan struct{}
+	err    error
+
+	closeOnce sync.Once
+}
+
+// NewWatcher starts watching kernel uevents for serial ports.
+func NewWatcher() (*Watcher, error) {
+	src, err := OpenUeventSocket()
+	if err != nil {
+		return nil, err
+	}
+	return NewWatcherSource(src, "/"), nil
+}
+
+// NewWatcherSource starts a Watcher reading uevents from src, looking up
+// port information in the sysfs tree below root (see ListPortsRoot).
+// The Watcher takes ownership of src.
+func NewWatcherSource(src UeventSource, root string) *Watcher {
+	w := &Watcher{
+		src:    src,
+		root:   root,
+		known:  make(map[string]*PortInfo),
+		events: make(chan HotplugEvent),
+		quit:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	if ports, err := ListPortsRoot(root); err == nil {
+		for _, info := range ports {
+			w.known[info.Name] = info
+		}
+	}
+	go w.run()
+	return w
+}
+
+// Events returns the channel on which hotplug events are delivered.
+// The channel is closed when the Watcher is closed or fails, see Err.
+func (w *Watcher) Events() <-chan HotplugEvent {
+	return w.events
+}
+
+// Err returns the error that stopped the Watcher, if any.
+// It is only valid after the Events channel has been closed.
+func (w *Watcher) Err() error {
+	return w.err
+}
+
+// Close stops the Watcher and closes its uevent source.
+func (w *Watcher) Close() error {
+	err := error(ErrClosed)
+	w.closeOnce.Do(func() {
+		close(w.quit)
+		if err = w.src.Close(); err == ErrClosed {
+			err = nil
+		}
+		<-w.done
+	})
+	return err
+}
+
+func (w *Watcher) run() {
+	defer close(w.done)
+	defer close(w.events)
+	for {
+		var events []HotplugEvent
+		msg, err := w.src.ReadUevent()
+		switch {
+		case errors.Is(err, syscall.ENOBUFS):
+			events = w.resync()
+		case err != nil:
+			select {
+			case <-w.quit:
+			default:
+				w.err = err
+			}
+			return
+		default:
+			if ev, ok := w.handle(msg); ok {
+				events = append(events, ev)
+			}
+		}
+		for _, ev := range events {
+			select {
+			case w.events <- ev:
+			case <-w.quit:
+				return
+			}
+		}
+	}
+}
+
+// resync rescans the ports after uevents were lost and returns the
+// differences to the known ports, removals first.
+func (w *Watcher) resync() []HotplugEvent {
+	ports, err := ListPortsRoot(w.root)
+	if err != nil {
+		return nil
+	}
+	present := make(map[string]*PortInfo, len(ports))
+	for _, info := range ports {
+		present[info.Name] = info
+	}
+	var events []HotplugEvent
+	for _, name := range sortedNames(w.known) {
+		if _, ok := present[name]; !ok {
+			events = append(events, HotplugEvent{Action: PortRemoved, Port: w.known[name]})
+			delete(w.known, name)
+		}
+	}
+	for _, info := range ports {
+		if _, ok := w.known[info.Name]; !ok {
+			events = append(events, HotplugEvent{Action: PortAdded, Port: info})
+		}
+		w.known[info.Name] = info
+	}
+	return events
+}
+
+func sortedNames(ports map[string]*PortInfo) []string {
+	names := make([]string, 0, len(ports))
+	for name := range ports {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// handle turns a uevent message into a HotplugEvent, if it concerns a serial port.
+func (w *Watcher) handle(msg []byte) (HotplugEvent, bool) {
+	// Kernel messages start with an "action@devpath" header.
+	i := bytes.IndexByte(msg, 0)
+	if i < 0 || !bytes.Contains(msg[:i], []byte("@")) {
+		return HotplugEvent{}, false
+	}
+	env := parseUevent(msg[i+1:], 0)
+	if env["SUBSYSTEM"] != "tty" {
+		return HotplugEvent{}, false
+	}
+	name := path.Base(env["DEVPATH"])
+	switch env["ACTION"] {
+	case "add":
+		info := readPortInfo(w.root, name)
+		if info == nil {
+			return HotplugEvent{}, false
+		}
+		info.ByID = readDevLinks(w.root, "dev/serial/by-id")[info.Device]
+		info.ByPath = readDevLinks(w.root, "dev/serial/by-path")[info.Device]
+		w.known[name] = info
+		return HotplugEvent{Action: PortAdded, Port: info}, true
+	case "remove":
+		info, ok := w.known[name]
+		if !ok {
+			if strings.HasPrefix(env["DEVPATH"], "/devices/virtual/") {
+				return HotplugEvent{}, false
+			}
+			info = &PortInfo{Name: name, Device: "/dev/" + name, Interface: -1}
+			if devName := env["DEVNAME"]; devName != "" {
+				info.Device = "/dev/" + devName
+			}
+		}
+		delete(w.known, name)
+		return HotplugEvent{Action: PortRemoved, Port: info}, true
+	}
+	return HotplugEvent{}, false
+}
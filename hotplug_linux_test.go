@@ -0,0 +1,173 @@
+package serial
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// fakeUevents is an UeventSource fed by the test.
+type fakeUevents struct {
+	msgs   chan []byte
+	errs   chan error
+	closed chan struct{}
+}
+
+func newFakeUevents() *fakeUevents {
+	return &fakeUevents{
+		msgs:   make(chan []byte, 16),
+		errs:   make(chan error, 1),
+		closed: make(chan struct{}),
+	}
+}
+
+func (f *fakeUevents) ReadUevent() ([]byte, error) {
+	select {
+	case msg := <-f.msgs:
+		return msg, nil
+	case err := <-f.errs:
+		return nil, err
+	case <-f.closed:
+		return nil, ErrClosed
+	}
+}
+
+func (f *fakeUevents) Close() error {
+	close(f.closed)
+	return nil
+}
+
+func (f *fakeUevents) send(action, devpath string) {
+	msg := action + "@" + devpath + "\x00ACTION=" + action + "\x00DEVPATH=" + devpath +
+		"\x00SUBSYSTEM=tty\x00DEVNAME=" + filepath.Base(devpath) + "\x00"
+	f.msgs <- []byte(msg)
+}
+
+// addUSBPort creates the sysfs entries of a USB serial adapter below root
+// and returns the devpath of its tty.
+func addUSBPort(t *testing.T, root, name, usb string) string {
+	t.Helper()
+	usbDir := filepath.Join(root, "sys/devices/pci0000:00/usb1", usb)
+	portDir := filepath.Join(usbDir, usb+":1.0", name)
+	ttyDir := filepath.Join(portDir, "tty", name)
+	for _, dir := range []string{ttyDir, filepath.Join(root, "sys/class/tty"), filepath.Join(root, "dev/serial/by-id")} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files := map[string]string{
+		filepath.Join(usbDir, "idVendor"):                     "0403\n",
+		filepath.Join(usbDir, "idProduct"):                    "6001\n",
+		filepath.Join(usbDir, "serial"):                       "A1" + name + "\n",
+		filepath.Join(usbDir, usb+":1.0", "bInterfaceNumber"): "00\n",
+		filepath.Join(ttyDir, "uevent"):                       "MAJOR=188\nDEVNAME=" + name + "\n",
+	}
+	for file, data := range files {
+		if err := os.WriteFile(file, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	links := map[string]string{
+		filepath.Join(ttyDir, "device"):                           "../../../" + name,
+		filepath.Join(portDir, "driver"):                          "../../../../../../bus/usb-serial/drivers/ftdi_sio",
+		filepath.Join(portDir, "subsystem"):                       "../../../../../../bus/usb-serial",
+		filepath.Join(root, "sys/class/tty", name):                "../../devices/pci0000:00/usb1/" + usb + "/" + usb + ":1.0/" + name + "/tty/" + name,
+		filepath.Join(root, "dev/serial/by-id", "usb-FTDI-"+name): "../../" + name,
+	}
+	for link, target := range links {
+		if err := os.Symlink(target, link); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return "/devices/pci0000:00/usb1/" + usb + "/" + usb + ":1.0/" + name + "/tty/" + name
+}
+
+func removeUSBPort(t *testing.T, root, name, usb string) {
+	t.Helper()
+	os.Remove(filepath.Join(root, "sys/class/tty", name))
+	os.Remove(filepath.Join(root, "dev/serial/by-id", "usb-FTDI-"+name))
+	if err := os.RemoveAll(filepath.Join(root, "sys/devices/pci0000:00/usb1", usb)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func nextEvent(t *testing.T, w *Watcher) HotplugEvent {
+	t.Helper()
+	select {
+	case ev, ok := <-w.Events():
+		if !ok {
+			t.Fatalf("Events closed: %v", w.Err())
+		}
+		return ev
+	case <-time.After(time.Second):
+		t.Fatal("no event")
+	}
+	return HotplugEvent{}
+}
+
+func TestWatcher(t *testing.T) {
+	root := t.TempDir()
+	addUSBPort(t, root, "ttyUSB0", "1-1")
+	src := newFakeUevents()
+	w := NewWatcherSource(src, root)
+	defer w.Close()
+
+	devpath := addUSBPort(t, root, "ttyUSB1", "1-2")
+	src.msgs <- []byte("add@/devices/virtual/net/lo\x00ACTION=add\x00SUBSYSTEM=net\x00")
+	src.send("add", devpath)
+	ev := nextEvent(t, w)
+	if ev.Action != PortAdded || ev.Port.Device != "/dev/ttyUSB1" {
+		t.Fatalf("got %v %+v, want Added /dev/ttyUSB1", ev.Action, ev.Port)
+	}
+	if ev.Port.VID != 0x0403 || ev.Port.PID != 0x6001 || ev.Port.Driver != "ftdi_sio" || ev.Port.Interface != 0 {
+		t.Fatalf("wrong port info %+v", ev.Port)
+	}
+	if len(ev.Port.ByID) != 1 || ev.Port.ByID[0] != "/dev/serial/by-id/usb-FTDI-ttyUSB1" {
+		t.Fatalf("got ByID %v", ev.Port.ByID)
+	}
+
+	removeUSBPort(t, root, "ttyUSB1", "1-2")
+	src.send("remove", devpath)
+	ev = nextEvent(t, w)
+	if ev.Action != PortRemoved || ev.Port.SerialNumber != "A1ttyUSB1" {
+		t.Fatalf("got %v %+v, want Removed with the known port info", ev.Action, ev.Port)
+	}
+}
+
+func TestWatcherResync(t *testing.T) {
+	root := t.TempDir()
+	addUSBPort(t, root, "ttyUSB0", "1-1")
+	src := newFakeUevents()
+	w := NewWatcherSource(src, root)
+	defer w.Close()
+
+	// Events lost while ttyUSB0 went away and ttyUSB1 and ttyUSB2 arrived.
+	removeUSBPort(t, root, "ttyUSB0", "1-1")
+	addUSBPort(t, root, "ttyUSB1", "1-2")
+	addUSBPort(t, root, "ttyUSB2", "1-3")
+	src.errs <- wrapErr("ReadUevent", syscall.ENOBUFS)
+
+	want := []struct {
+		action HotplugAction
+		device string
+	}{
+		{PortRemoved, "/dev/ttyUSB0"},
+		{PortAdded, "/dev/ttyUSB1"},
+		{PortAdded, "/dev/ttyUSB2"},
+	}
+	for _, exp := range want {
+		ev := nextEvent(t, w)
+		if ev.Action != exp.action || ev.Port.Device != exp.device {
+			t.Fatalf("got %v %s, want %v %s", ev.Action, ev.Port.Device, exp.action, exp.device)
+		}
+	}
+
+	// The Watcher keeps going after the resync.
+	removeUSBPort(t, root, "ttyUSB2", "1-3")
+	src.send("remove", "/devices/pci0000:00/usb1/1-3/1-3:1.0/ttyUSB2/tty/ttyUSB2")
+	if ev := nextEvent(t, w); ev.Action != PortRemoved || ev.Port.Device != "/dev/ttyUSB2" {
+		t.Fatalf("got %v %s, want Removed /dev/ttyUSB2", ev.Action, ev.Port.Device)
+	}
+}
@@ -0,0 +1,26 @@
+// Package crc implements the CRC-16 shared by XMODEM, YMODEM and ZMODEM.
+package crc
+
+var table = func() (table [256]uint16) {
+	for i := range table {
+		crc := uint16(i) << 8
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+		table[i] = crc
+	}
+	return
+}()
+
+// CRC16 returns the CRC-16/XMODEM of data (polynomial 0x1021, initial value 0).
+func CRC16(data []byte) uint16 {
+	var crc uint16
+	for _, b := range data {
+		crc = crc<<8 ^ table[byte(crc>>8)^b]
+	}
+	return crc
+}
@@ -0,0 +1,19 @@
+package crc
+
+import "testing"
+
+func TestCRC16(t *testing.T) {
+	tests := []struct {
+		data string
+		crc  uint16
+	}{
+		{"", 0},
+		{"123456789", 0x31C3},
+		{"A", 0x58E5},
+	}
+	for _, tt := range tests {
+		if crc := CRC16([]byte(tt.data)); crc != tt.crc {
+			t.Errorf("CRC16(%q) = %#04x, want %#04x", tt.data, crc, tt.crc)
+		}
+	}
+}
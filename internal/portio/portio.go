@@ -0,0 +1,32 @@
+// Package portio provides the timed reads the file transfer protocols are built on.
+package portio
+
+import (
+	"context"
+	"errors"
+	serial "github.com/daedaluz/goserial"
+	"io"
+	"time"
+)
+
+// Read reads into data from port, waiting at most timeout and aborting when ctx is done.
+// An expired timeout is reported as serial.ErrTimeout, cancellation as the error of ctx.
+// Reading nothing means the line was hung up and is reported as io.ErrUnexpectedEOF.
+func Read(ctx context.Context, port *serial.Port, data []byte, timeout time.Duration) (int, error) {
+	var n int
+	var err error
+	if ctx.Done() == nil {
+		n, err = port.ReadTimeout(data, timeout)
+	} else {
+		tctx, cancel := context.WithTimeout(ctx, timeout)
+		n, err = port.ReadContext(tctx, data)
+		cancel()
+		if err != nil && ctx.Err() == nil && errors.Is(err, context.DeadlineExceeded) {
+			err = serial.ErrTimeout
+		}
+	}
+	if err == nil && n == 0 {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
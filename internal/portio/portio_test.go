@@ -0,0 +1,40 @@
+package portio
+
+import (
+	"context"
+	"errors"
+	serial "github.com/daedaluz/goserial"
+	"github.com/daedaluz/goserial/internal/ptytest"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestRead(t *testing.T) {
+	master, slave := ptytest.Pair(t)
+	buf := make([]byte, 16)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	for _, ctx := range []context.Context{context.Background(), ctx} {
+		if _, err := Read(ctx, slave, buf, 20*time.Millisecond); !errors.Is(err, serial.ErrTimeout) {
+			t.Fatalf("got %v, want ErrTimeout", err)
+		}
+		if _, err := master.Write([]byte("ab")); err != nil {
+			t.Fatal(err)
+		}
+		if n, err := Read(ctx, slave, buf, time.Second); err != nil || string(buf[:n]) != "ab" {
+			t.Fatalf("got %q, %v", buf[:n], err)
+		}
+	}
+
+	time.AfterFunc(20*time.Millisecond, cancel)
+	if _, err := Read(ctx, slave, buf, time.Second); !errors.Is(err, context.Canceled) {
+		t.Fatalf("got %v, want %v", err, context.Canceled)
+	}
+
+	master.Close()
+	if _, err := Read(context.Background(), slave, buf, time.Second); err != io.ErrUnexpectedEOF {
+		t.Fatalf("after hangup: got %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+}
@@ -0,0 +1,26 @@
+// Package ptytest provides pseudo-terminal fixtures for the tests of the protocol packages.
+package ptytest
+
+import (
+	serial "github.com/daedaluz/goserial"
+	"testing"
+)
+
+// Pair returns the two ends of a pseudo-terminal in raw mode, closed when the test ends.
+func Pair(t testing.TB) (master, slave *serial.Port) {
+	t.Helper()
+	master, slave, err := serial.OpenPTY(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		master.Close()
+		slave.Close()
+	})
+	for _, p := range []*serial.Port{master, slave} {
+		if err := p.MakeRaw(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return master, slave
+}
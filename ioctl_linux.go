@@ -34,6 +34,9 @@ var (
 	tiocmbic = uintptr(0x5417) // clear indicated bits
 	tiocmset = uintptr(0x5418) // set status
 
+	tiocmiwait  = uintptr(0x545C) // wait for a change on serial input line(s)
+	tiocgicount = uintptr(0x545D) // read serial port inline interrupt counts
+
 	tiocgrs485 = uintptr(0x542E)
 	tiocsrs485 = uintptr(0x542F)
 
@@ -48,6 +51,9 @@ var (
 	tiocgptlck  = ioctl.IOR('T', 0x39, unsafe.Sizeof(int32(0)))
 	tiocgptpeer = ioctl.IO('T', 0x41)
 
+	tiocsetd = uintptr(0x5423)
+	tiocgetd = uintptr(0x5424)
+
 	tiocgpgrp = uintptr(0x540F)
 	tiocspgrp = uintptr(0x5410)
 	tiocgsid  = uintptr(0x5429)
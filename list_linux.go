@@ -0,0 +1,179 @@
+package serial
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// PortInfo describes a serial port discovered through sysfs.
+type PortInfo struct {
+	// Name is the kernel name of the port, e.g. ttyUSB0.
+	Name string
+	// Device is the path of the device node, e.g. /dev/ttyUSB0.
+	Device string
+	// Driver is the kernel driver bound to the port, e.g. ftdi_sio.
+	Driver string
+	// Subsystem is the bus the port is attached to, e.g. usb, usb-serial, pnp or platform.
+	Subsystem string
+
+	// VID is the USB vendor id, zero if the port is not a USB port.
+	VID uint16
+	// PID is the USB product id, zero if the port is not a USB port.
+	PID          uint16
+	SerialNumber string
+	Manufacturer string
+	Product      string
+	// Interface is the USB interface number, -1 if the port is not a USB port.
+	Interface int
+
+	// ByID holds the /dev/serial/by-id symlinks pointing at the device.
+	ByID []string
+	// ByPath holds the /dev/serial/by-path symlinks pointing at the device.
+	ByPath []string
+}
+
+// IsUSB returns true if the port is provided by a USB device.
+func (p *PortInfo) IsUSB() bool {
+	return p.VID != 0 || p.PID != 0
+}
+
+// ListPorts returns the serial ports present on the system, sorted by device path.
+// Virtual consoles and serial core ports without a UART behind them are left out.
+func ListPorts() ([]*PortInfo, error) {
+	return ListPortsRoot("/")
+}
+
+// ListPortsRoot is like ListPorts, but looks up sys/class/tty and dev/serial
+// below root rather than /, which allows running against a fake sysfs tree.
+// Symlinks in the tree must be relative, as they are in sysfs.
+func ListPortsRoot(root string) ([]*PortInfo, error) {
+	entries, err := os.ReadDir(filepath.Join(root, "sys/class/tty"))
+	if err != nil {
+		return nil, wrapErr("ListPorts", err)
+	}
+	byID := readDevLinks(root, "dev/serial/by-id")
+	byPath := readDevLinks(root, "dev/serial/by-path")
+	ports := make([]*PortInfo, 0, len(entries))
+	for _, entry := range entries {
+		info := readPortInfo(root, entry.Name())
+		if info == nil {
+			continue
+		}
+		info.ByID = byID[info.Device]
+		info.ByPath = byPath[info.Device]
+		ports = append(ports, info)
+	}
+	sort.Slice(ports, func(i, j int) bool {
+		return ports[i].Device < ports[j].Device
+	})
+	return ports, nil
+}
+
+// readPortInfo collects the sysfs attributes of the tty with the given name.
+// It returns nil if the tty is not backed by a device.
+func readPortInfo(root, name string) *PortInfo {
+	dir := filepath.Join(root, "sys/class/tty", name)
+	devDir, err := filepath.EvalSymlinks(filepath.Join(dir, "device"))
+	if err != nil {
+		// Virtual consoles, ptmx and friends have no device.
+		return nil
+	}
+	if readAttr(dir, "type") == "0" {
+		// Serial core port (PORT_UNKNOWN) with no UART present.
+		return nil
+	}
+	// Since Linux 6.5 serial core ports hang off serial-base devices;
+	// the driver of interest is bound to the controller above them.
+	hwDir := devDir
+	for readLinkBase(filepath.Join(hwDir, "subsystem")) == "serial-base" {
+		hwDir = filepath.Dir(hwDir)
+	}
+	info := &PortInfo{
+		Name:      name,
+		Device:    "/dev/" + name,
+		Driver:    readLinkBase(filepath.Join(hwDir, "driver")),
+		Subsystem: readLinkBase(filepath.Join(hwDir, "subsystem")),
+		Interface: -1,
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "uevent")); err == nil {
+		if devName := parseUevent(data, '\n')["DEVNAME"]; devName != "" {
+			info.Device = "/dev/" + devName
+		}
+	}
+	// Walk up towards the USB device, picking up the interface on the way.
+	devices := filepath.Join(root, "sys/devices")
+	if d, err := filepath.EvalSymlinks(devices); err == nil {
+		devices = d
+	}
+	for d := devDir; strings.HasPrefix(d, devices+string(filepath.Separator)); d = filepath.Dir(d) {
+		if info.Interface < 0 {
+			if x, err := strconv.ParseUint(readAttr(d, "bInterfaceNumber"), 16, 8); err == nil {
+				info.Interface = int(x)
+			}
+		}
+		vid, err := strconv.ParseUint(readAttr(d, "idVendor"), 16, 16)
+		if err != nil {
+			continue
+		}
+		pid, _ := strconv.ParseUint(readAttr(d, "idProduct"), 16, 16)
+		info.VID = uint16(vid)
+		info.PID = uint16(pid)
+		info.SerialNumber = readAttr(d, "serial")
+		info.Manufacturer = readAttr(d, "manufacturer")
+		info.Product = readAttr(d, "product")
+		break
+	}
+	return info
+}
+
+// readDevLinks maps device paths to the symlinks in dir pointing at them.
+func readDevLinks(root, dir string) map[string][]string {
+	links := make(map[string][]string)
+	entries, err := os.ReadDir(filepath.Join(root, dir))
+	if err != nil {
+		return links
+	}
+	for _, entry := range entries {
+		target, err := os.Readlink(filepath.Join(root, dir, entry.Name()))
+		if err != nil {
+			continue
+		}
+		if !filepath.IsAbs(target) {
+			target = filepath.Join("/", dir, target)
+		}
+		links[target] = append(links[target], filepath.Join("/", dir, entry.Name()))
+	}
+	return links
+}
+
+func readAttr(dir, name string) string {
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return ""
+	}
+	return string(bytes.TrimSpace(data))
+}
+
+func readLinkBase(path string) string {
+	target, err := os.Readlink(path)
+	if err != nil {
+		return ""
+	}
+	return filepath.Base(target)
+}
+
+// parseUevent parses KEY=VALUE pairs separated by sep,
+// as found in sysfs uevent files and kernel uevent messages.
+func parseUevent(data []byte, sep byte) map[string]string {
+	env := make(map[string]string)
+	for _, field := range bytes.Split(data, []byte{sep}) {
+		if i := bytes.IndexByte(field, '='); i > 0 {
+			env[string(field[:i])] = string(field[i+1:])
+		}
+	}
+	return env
+}
@@ -0,0 +1,156 @@
+package serial
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// DefaultLockDir is where minicom, picocom and cu keep their lock files.
+const DefaultLockDir = "/var/lock"
+
+// LockError is returned by Open when the port is locked by another process.
+// PID is 0 if the lock file holds no valid pid.
+type LockError struct {
+	Path string
+	PID  int
+}
+
+func (e *LockError) Error() string {
+	if e.PID <= 0 {
+		return fmt.Sprintf("%s held by unknown process", e.Path)
+	}
+	return fmt.Sprintf("%s held by pid %d", e.Path, e.PID)
+}
+
+func (e *LockError) Unwrap() error {
+	return ErrLocked
+}
+
+// lockFilePath returns the UUCP lock file for device, named after the
+// device node rather than any symlink pointing at it.
+// As with lockdev, the path below /dev is used with '/' replaced by '_',
+// so /dev/pts/0 is locked by LCK..pts_0.
+func lockFilePath(dir, device string) string {
+	if abs, err := filepath.Abs(device); err == nil {
+		device = abs
+	}
+	if target, err := filepath.EvalSymlinks(device); err == nil {
+		device = target
+	}
+	name := filepath.Base(device)
+	if strings.HasPrefix(device, "/dev/") {
+		name = strings.ReplaceAll(device[len("/dev/"):], "/", "_")
+	}
+	return filepath.Join(dir, "LCK.."+name)
+}
+
+// errMalformedLock is returned by readLockPID for lock files without a valid pid.
+var errMalformedLock = errors.New("malformed lock file")
+
+// readLockPID returns the pid stored in a lock file,
+// either in the ASCII (HDB) or the binary (old UUCP) format.
+func readLockPID(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	if pid, err := strconv.Atoi(strings.TrimSpace(string(data))); err == nil {
+		return pid, nil
+	}
+	if len(data) == 4 {
+		return int(int32(binary.LittleEndian.Uint32(data))), nil
+	}
+	return 0, errMalformedLock
+}
+
+// lockWriteTimeout is how long a lock file may stay without a valid pid,
+// as another process creates it empty and writes the pid afterwards.
+const lockWriteTimeout = 200 * time.Millisecond
+
+// waitLockPID reads the pid of a lock file like readLockPID,
+// giving the process that created it lockWriteTimeout to write it.
+func waitLockPID(path string) (int, error) {
+	deadline := time.Now().Add(lockWriteTimeout)
+	for {
+		pid, err := readLockPID(path)
+		if err != errMalformedLock || time.Now().After(deadline) {
+			return pid, err
+		}
+		time.Sleep(lockWriteTimeout / 10)
+	}
+}
+
+// processAlive returns true if a process with the given pid exists.
+func processAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	err := syscall.Kill(pid, 0)
+	return err == nil || err == syscall.EPERM
+}
+
+// createLockFile atomically creates the lock file for device in dir,
+// replacing it if the process holding it is gone.
+// A lock file without a valid pid is considered held, as it may be in the middle of being written.
+func createLockFile(dir, device string) (string, error) {
+	path := lockFilePath(dir, device)
+	tmp, err := os.CreateTemp(dir, "LTMP.")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = fmt.Fprintf(tmp, "%10d\n", os.Getpid())
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return "", err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return "", err
+	}
+	for retry := 0; ; retry++ {
+		// Linking is atomic and fails if the lock file already exists.
+		err := os.Link(tmp.Name(), path)
+		if err == nil {
+			return path, nil
+		}
+		if !os.IsExist(err) || retry > 2 {
+			return "", err
+		}
+		pid, err := waitLockPID(path)
+		switch {
+		case os.IsNotExist(err):
+			// Released meanwhile.
+			continue
+		case err == errMalformedLock:
+			return "", &LockError{Path: path}
+		case err != nil:
+			return "", err
+		case processAlive(pid):
+			return "", &LockError{Path: path, PID: pid}
+		}
+		// Stale lock file, left behind by a process that is gone.
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return "", err
+		}
+	}
+}
+
+// removeLockFile removes a lock file created by createLockFile,
+// unless it was taken over by another process in the meantime.
+func removeLockFile(path string) {
+	if path == "" {
+		return
+	}
+	if pid, err := readLockPID(path); err == nil && pid == os.Getpid() {
+		os.Remove(path)
+	}
+}
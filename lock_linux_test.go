@@ -0,0 +1,153 @@
+package serial
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLockFilePath(t *testing.T) {
+	dir := t.TempDir()
+	link := filepath.Join(dir, "modem")
+	if err := os.Symlink("/dev/null", link); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		device, want string
+	}{
+		{"/dev/ttyUSB0", "LCK..ttyUSB0"},
+		{"/dev/pts/0", "LCK..pts_0"},
+		{"/dev/serial/../pts/3", "LCK..pts_3"},
+		{link, "LCK..null"},
+	}
+	for _, tt := range tests {
+		if got := lockFilePath("/var/lock", tt.device); got != filepath.Join("/var/lock", tt.want) {
+			t.Errorf("lockFilePath(%q) = %q, want %q", tt.device, got, tt.want)
+		}
+	}
+}
+
+// exitedPID returns the pid of a process that has exited.
+func exitedPID(t *testing.T) int {
+	cmd := exec.Command("true")
+	if err := cmd.Run(); err != nil {
+		t.Skip(err)
+	}
+	return cmd.Process.Pid
+}
+
+func TestCreateLockFile(t *testing.T) {
+	dir := t.TempDir()
+	device := "/dev/ttyTEST0"
+	path := filepath.Join(dir, "LCK..ttyTEST0")
+
+	held := []struct {
+		name    string
+		content []byte
+		pid     int
+	}{
+		{"live process", []byte(fmt.Sprintf("%10d\n", os.Getppid())), os.Getppid()},
+		{"binary format", []byte{byte(os.Getppid()), byte(os.Getppid() >> 8), byte(os.Getppid() >> 16), 0}, os.Getppid()},
+		{"empty", nil, 0},
+		{"garbage", []byte("locked\n"), 0},
+	}
+	for _, tt := range held {
+		if err := os.WriteFile(path, tt.content, 0644); err != nil {
+			t.Fatal(err)
+		}
+		_, err := createLockFile(dir, device)
+		var lockErr *LockError
+		if !errors.As(err, &lockErr) || lockErr.PID != tt.pid || !errors.Is(err, ErrLocked) {
+			t.Errorf("%s: got %v, want held by pid %d", tt.name, err, tt.pid)
+		}
+		if data, _ := os.ReadFile(path); string(data) != string(tt.content) {
+			t.Errorf("%s: lock file changed to %q", tt.name, data)
+		}
+	}
+
+	// The pid written shortly after the lock file was created is picked up.
+	if err := os.WriteFile(path, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	written := make(chan error, 1)
+	go func() {
+		time.Sleep(lockWriteTimeout / 4)
+		written <- os.WriteFile(path, []byte(fmt.Sprintf("%10d\n", os.Getppid())), 0644)
+	}()
+	_, err := createLockFile(dir, device)
+	if err := <-written; err != nil {
+		t.Fatal(err)
+	}
+	var lockErr *LockError
+	if !errors.As(err, &lockErr) || lockErr.PID != os.Getppid() {
+		t.Errorf("lock being written: got %v, want held by pid %d", err, os.Getppid())
+	}
+
+	// A lock file left behind by a process that is gone is replaced.
+	if err := os.WriteFile(path, []byte(fmt.Sprintf("%10d\n", exitedPID(t))), 0644); err != nil {
+		t.Fatal(err)
+	}
+	got, err := createLockFile(dir, device)
+	if err != nil || got != path {
+		t.Fatalf("stale lock: got %q, %v", got, err)
+	}
+	if pid, err := readLockPID(path); err != nil || pid != os.Getpid() {
+		t.Fatalf("lock file holds %d, %v", pid, err)
+	}
+	if _, err := createLockFile(dir, device); !errors.Is(err, ErrLocked) {
+		t.Fatalf("second lock: got %v, want ErrLocked", err)
+	}
+	removeLockFile(path)
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("lock file not removed: %v", err)
+	}
+
+	// Lock files taken over by another process are left alone.
+	if err := os.WriteFile(path, []byte(fmt.Sprintf("%10d\n", os.Getppid())), 0644); err != nil {
+		t.Fatal(err)
+	}
+	removeLockFile(path)
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("lock file of another process removed: %v", err)
+	}
+	if matches, _ := filepath.Glob(filepath.Join(dir, "LTMP.*")); len(matches) != 0 {
+		t.Fatalf("temporary files left behind: %v", matches)
+	}
+}
+
+func TestOpenLockDir(t *testing.T) {
+	master, slave, err := OpenPTY(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer master.Close()
+	defer slave.Close()
+	n, err := master.PTSNumber()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	name := fmt.Sprintf("/dev/pts/%d", n)
+	path := filepath.Join(dir, fmt.Sprintf("LCK..pts_%d", n))
+
+	p, err := Open(name, NewOptions().SetLockDir(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(name, NewOptions().SetLockDir(dir)); !errors.Is(err, ErrLocked) {
+		t.Fatalf("second Open: got %v, want ErrLocked", err)
+	}
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("lock file not removed by Close: %v", err)
+	}
+}
@@ -0,0 +1,230 @@
+package modbus
+
+import (
+	"context"
+	"errors"
+	serial "github.com/daedaluz/goserial"
+	"io"
+	"time"
+)
+
+// maxASCIIFrame is the maximum number of characters between the ':' and the CR LF of an ASCII frame.
+const maxASCIIFrame = 2 * (maxRTUFrame - 1)
+
+// ASCIICharTimeout is the longest pause tolerated between two characters of an ASCII frame.
+var ASCIICharTimeout = time.Second
+
+const hexDigits = "0123456789ABCDEF"
+
+// LRC returns the longitudinal redundancy check of data, the two's complement of its byte sum.
+func LRC(data []byte) byte {
+	var sum byte
+	for _, b := range data {
+		sum += b
+	}
+	return -sum
+}
+
+// SetASCIIFraming configures port for the standard Modbus ASCII character
+// framing of 7 data bits, even parity and 1 stop bit, keeping the baud rate.
+func SetASCIIFraming(port *serial.Port) error {
+	attrs, err := port.GetAttr2()
+	if err != nil {
+		return err
+	}
+	attrs.Cflag &= ^(serial.CSIZE | serial.PARODD | serial.CMSPAR | serial.CSTOPB)
+	attrs.Cflag |= serial.CS7 | serial.PARENB
+	attrs.Iflag |= serial.INPCK
+	return port.SetAttr2(serial.TCSANOW, attrs)
+}
+
+// asciiTransport frames PDUs as ASCII ADUs: a ':', the unit id, the PDU and
+// an LRC as hexadecimal digits, and a CR LF.
+type asciiTransport struct {
+	port *serial.Port
+	// pending holds input read past the end of the last frame.
+	pending []byte
+}
+
+func newASCIITransport(port *serial.Port) (*asciiTransport, error) {
+	if err := SetASCIIFraming(port); err != nil {
+		return nil, err
+	}
+	return &asciiTransport{port: port}, nil
+}
+
+// NewASCIIClient returns a Modbus ASCII Client on port.
+// The port is switched to 7E1 framing, reconfigure it afterwards for devices using other framing.
+func NewASCIIClient(port *serial.Port) (*Client, error) {
+	t, err := newASCIITransport(port)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{Timeout: DefaultTimeout, transport: t}, nil
+}
+
+// NewASCIIServer returns a Modbus ASCII Server on port answering for unit.
+// The port is switched to 7E1 framing, reconfigure it afterwards for masters using other framing.
+func NewASCIIServer(port *serial.Port, unit byte, handler Handler) (*Server, error) {
+	t, err := newASCIITransport(port)
+	if err != nil {
+		return nil, err
+	}
+	return &Server{unit: unit, handler: handler, transport: t}, nil
+}
+
+func (t *asciiTransport) writeFrame(unit byte, pdu *PDU) error {
+	adu := make([]byte, 0, len(pdu.Data)+3)
+	adu = append(adu, unit, pdu.Function)
+	adu = append(adu, pdu.Data...)
+	adu = append(adu, LRC(adu))
+	if 2*len(adu) > maxASCIIFrame {
+		return ErrFrameTooLong
+	}
+	frame := make([]byte, 0, 2*len(adu)+3)
+	frame = append(frame, ':')
+	for _, b := range adu {
+		frame = append(frame, hexDigits[b>>4], hexDigits[b&0x0f])
+	}
+	frame = append(frame, '\r', '\n')
+	if _, err := t.port.Write(frame); err != nil {
+		return err
+	}
+	return t.port.Drain()
+}
+
+// readFrame reads a single frame and verifies its LRC.
+//
+// Characters before the ':' are skipped, and a ':' within a frame starts a new one.
+// The ':' is awaited until ctx is done or the timeout expires, a negative timeout waits forever.
+// Once a frame has started, each character must follow within ASCIICharTimeout.
+func (t *asciiTransport) readFrame(ctx context.Context, timeout time.Duration) ([]byte, error) {
+	var deadline time.Time
+	if timeout > -1 {
+		deadline = time.Now().Add(timeout)
+		if ctx.Done() != nil {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithDeadline(ctx, deadline)
+			defer cancel()
+		}
+	}
+	buf := make([]byte, maxASCIIFrame)
+	frame := make([]byte, 0, maxASCIIFrame)
+	started := false
+	for {
+		for len(t.pending) > 0 {
+			c := t.pending[0] & 0x7f
+			t.pending = t.pending[1:]
+			switch {
+			case c == ':':
+				started = true
+				frame = frame[:0]
+			case !started:
+			case c == '\n':
+				if len(frame) == 0 || frame[len(frame)-1] != '\r' {
+					return nil, ErrInvalidFrame
+				}
+				return decodeASCII(frame[:len(frame)-1])
+			case len(frame) > maxASCIIFrame:
+				return nil, ErrFrameTooLong
+			default:
+				frame = append(frame, c)
+			}
+		}
+		var n int
+		var err error
+		switch {
+		case started:
+			n, err = t.port.ReadTimeout(buf, ASCIICharTimeout)
+			if errors.Is(err, serial.ErrTimeout) {
+				return nil, io.ErrUnexpectedEOF
+			}
+		case ctx.Done() != nil:
+			n, err = t.port.ReadContext(ctx, buf)
+		case !deadline.IsZero():
+			wait := time.Until(deadline)
+			if wait <= 0 {
+				return nil, serial.ErrTimeout
+			}
+			n, err = t.port.ReadTimeout(buf, wait)
+		default:
+			n, err = t.port.Read(buf)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if n == 0 {
+			return nil, io.ErrUnexpectedEOF
+		}
+		t.pending = buf[:n]
+	}
+}
+
+// decodeASCII decodes the hexadecimal digits of a frame and verifies its LRC.
+func decodeASCII(digits []byte) ([]byte, error) {
+	if len(digits)%2 != 0 || len(digits) < 6 {
+		return nil, ErrInvalidFrame
+	}
+	adu := make([]byte, len(digits)/2)
+	for i := range adu {
+		hi, ok1 := fromHex(digits[2*i])
+		lo, ok2 := fromHex(digits[2*i+1])
+		if !ok1 || !ok2 {
+			return nil, ErrInvalidFrame
+		}
+		adu[i] = hi<<4 | lo
+	}
+	if LRC(adu) != 0 {
+		return nil, ErrCRC
+	}
+	return adu[:len(adu)-1], nil
+}
+
+func fromHex(c byte) (byte, bool) {
+	switch {
+	case c >= '0' && c <= '9':
+		return c - '0', true
+	case c >= 'A' && c <= 'F':
+		return c - 'A' + 10, true
+	case c >= 'a' && c <= 'f':
+		return c - 'a' + 10, true
+	}
+	return 0, false
+}
+
+func (t *asciiTransport) send(unit byte, req *PDU, timeout time.Duration) (*PDU, error) {
+	if err := t.writeFrame(unit, req); err != nil {
+		return nil, err
+	}
+	if unit == 0 {
+		// Broadcasts are not answered.
+		return nil, nil
+	}
+	adu, err := t.readFrame(context.Background(), timeout)
+	if err != nil {
+		return nil, err
+	}
+	if adu[0] != unit {
+		return nil, ErrInvalidResponse
+	}
+	return &PDU{Function: adu[1], Data: adu[2:]}, nil
+}
+
+func (t *asciiTransport) readRequest(ctx context.Context, unit byte) (byte, *PDU, error) {
+	adu, err := t.readFrame(ctx, -1)
+	if err != nil {
+		return 0, nil, err
+	}
+	return adu[0], &PDU{Function: adu[1], Data: adu[2:]}, nil
+}
+
+func (t *asciiTransport) writeResponse(unit byte, resp *PDU) error {
+	return t.writeFrame(unit, resp)
+}
+
+// flush discards pending input. As every ASCII frame starts with a ':',
+// there is no need to wait for the line to become idle.
+func (t *asciiTransport) flush() error {
+	t.pending = nil
+	return t.port.Flush(serial.TCIFLUSH)
+}
@@ -0,0 +1,148 @@
+package modbus
+
+import (
+	"context"
+	"errors"
+	serial "github.com/daedaluz/goserial"
+	"github.com/daedaluz/goserial/internal/ptytest"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLRC(t *testing.T) {
+	// Read Holding Registers request from the specification examples.
+	if lrc := LRC([]byte{0x01, 0x03, 0x00, 0x00, 0x00, 0x01}); lrc != 0xFB {
+		t.Fatalf("got %#02x, want 0xfb", lrc)
+	}
+	if lrc := LRC(nil); lrc != 0 {
+		t.Fatalf("got %#02x for no data", lrc)
+	}
+}
+
+func TestDecodeASCII(t *testing.T) {
+	tests := []struct {
+		digits string
+		adu    []byte
+		err    error
+	}{
+		{"010300000001FB", []byte{0x01, 0x03, 0x00, 0x00, 0x00, 0x01}, nil},
+		{"010300000001fb", []byte{0x01, 0x03, 0x00, 0x00, 0x00, 0x01}, nil},
+		{"010300000001F", nil, ErrInvalidFrame},
+		{"0103000000G1FB", nil, ErrInvalidFrame},
+		{"0103FC", []byte{0x01, 0x03}, nil},
+		{"01FF", nil, ErrInvalidFrame},
+		{"010300000001FC", nil, ErrCRC},
+	}
+	for _, tt := range tests {
+		adu, err := decodeASCII([]byte(tt.digits))
+		if err != tt.err || !reflect.DeepEqual(adu, tt.adu) {
+			t.Errorf("%s: got % x, %v, want % x, %v", tt.digits, adu, err, tt.adu, tt.err)
+		}
+	}
+}
+
+func TestASCIIReadFrame(t *testing.T) {
+	master, slave := ptytest.Pair(t)
+	tr := &asciiTransport{port: slave}
+	want := []byte{0x01, 0x03, 0x00, 0x00, 0x00, 0x01}
+
+	tests := []struct {
+		name, input string
+		adu         []byte
+		err         error
+	}{
+		{"plain", ":010300000001FB\r\n", want, nil},
+		{"noise before the start", "\x00xx\r\n:010300000001FB\r\n", want, nil},
+		{"restart within a frame", ":0103:010300000001FB\r\n", want, nil},
+		{"parity bits", ":\xb010300000001FB\r\n", want, nil},
+		{"missing CR", ":010300000001FB\n", nil, ErrInvalidFrame},
+		{"bad LRC", ":010300000001FA\r\n", nil, ErrCRC},
+	}
+	for _, tt := range tests {
+		if _, err := master.Write([]byte(tt.input)); err != nil {
+			t.Fatal(err)
+		}
+		adu, err := tr.readFrame(context.Background(), time.Second)
+		if err != tt.err || !reflect.DeepEqual(adu, tt.adu) {
+			t.Errorf("%s: got % x, %v, want % x, %v", tt.name, adu, err, tt.adu, tt.err)
+		}
+	}
+	if len(tr.pending) != 0 {
+		t.Fatalf("input left over: %q", tr.pending)
+	}
+
+	// The start is awaited for the timeout, the rest of the frame for ASCIICharTimeout.
+	if _, err := tr.readFrame(context.Background(), 20*time.Millisecond); !errors.Is(err, serial.ErrTimeout) {
+		t.Fatalf("no frame: got %v, want ErrTimeout", err)
+	}
+	defer func(d time.Duration) { ASCIICharTimeout = d }(ASCIICharTimeout)
+	ASCIICharTimeout = 20 * time.Millisecond
+	if _, err := master.Write([]byte(":0103")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tr.readFrame(context.Background(), time.Second); err != io.ErrUnexpectedEOF {
+		t.Fatalf("frame cut short: got %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := tr.readFrame(ctx, -1); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("canceled: got %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestASCIIClientServer(t *testing.T) {
+	master, slave := ptytest.Pair(t)
+	memory := NewMemory(16)
+	memory.InputRegisters[4] = 0xCAFE
+	server, err := NewASCIIServer(slave, 5, memory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() {
+		served <- server.Serve(ctx)
+	}()
+	defer func() {
+		cancel()
+		if err := <-served; err != context.Canceled {
+			t.Errorf("Serve: %v", err)
+		}
+	}()
+
+	client, err := NewASCIIClient(master)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Timeout = 500 * time.Millisecond
+
+	if err := client.WriteMultipleRegisters(5, 1, []uint16{0x0A0B, 0x0C0D}); err != nil {
+		t.Fatal(err)
+	}
+	registers, err := client.ReadHoldingRegisters(5, 0, 3)
+	if err != nil || !reflect.DeepEqual(registers, []uint16{0, 0x0A0B, 0x0C0D}) {
+		t.Fatalf("ReadHoldingRegisters: got %x, %v", registers, err)
+	}
+	if err := client.WriteMultipleCoils(5, 2, []bool{true, true}); err != nil {
+		t.Fatal(err)
+	}
+	coils, err := client.ReadCoils(5, 0, 4)
+	if err != nil || !reflect.DeepEqual(coils, []bool{false, false, true, true}) {
+		t.Fatalf("ReadCoils: got %v, %v", coils, err)
+	}
+	registers, err = client.ReadInputRegisters(5, 4, 1)
+	if err != nil || registers[0] != 0xCAFE {
+		t.Fatalf("ReadInputRegisters: got %x, %v", registers, err)
+	}
+	if _, err := client.ReadHoldingRegisters(5, 15, 2); !errors.Is(err, IllegalDataAddress) {
+		t.Fatalf("got %v, want IllegalDataAddress", err)
+	}
+
+	// Requests for other units are not answered.
+	client.Timeout = 50 * time.Millisecond
+	if _, err := client.ReadHoldingRegisters(6, 0, 1); !errors.Is(err, serial.ErrTimeout) {
+		t.Fatalf("other unit: got %v, want ErrTimeout", err)
+	}
+}
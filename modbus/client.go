@@ -0,0 +1,286 @@
+package modbus
+
+import (
+	"errors"
+	serial "github.com/daedaluz/goserial"
+	"io"
+	"sync"
+	"time"
+)
+
+// DefaultTimeout is the default time a Client waits for a response.
+const DefaultTimeout = time.Second
+
+// transport sends a request PDU to a unit and reads the response PDU.
+type transport interface {
+	send(unit byte, req *PDU, timeout time.Duration) (*PDU, error)
+	// flush discards any pending input before a request is retried.
+	flush() error
+}
+
+// Client is a Modbus master.
+// Requests to unit 0 are broadcast and return without waiting for a response.
+type Client struct {
+	// Timeout is how long to wait for a response.
+	Timeout time.Duration
+	// Retries is how many times a request is repeated after a timeout
+	// or a corrupted response. Exception responses are never retried.
+	Retries int
+
+	mu        sync.Mutex
+	transport transport
+}
+
+// NewRTUClient returns a Modbus RTU Client on port.
+// The frame silence is computed from the baud rate the port is configured with,
+// so the port must be configured before calling NewRTUClient.
+func NewRTUClient(port *serial.Port) (*Client, error) {
+	t, err := newRTUTransport(port)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{Timeout: DefaultTimeout, transport: t}, nil
+}
+
+// retryable returns true for errors caused by a lost or corrupted response.
+func retryable(err error) bool {
+	return errors.Is(err, serial.ErrTimeout) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		err == ErrCRC || err == ErrInvalidResponse || err == ErrFrameTooLong || err == ErrInvalidFrame
+}
+
+// Send sends a raw request PDU to unit and returns the response PDU.
+// Exception responses are returned as *ExceptionError.
+func (c *Client) Send(unit byte, req *PDU) (*PDU, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var err error
+	for attempt := 0; attempt <= c.Retries; attempt++ {
+		if attempt > 0 {
+			if err := c.transport.flush(); err != nil {
+				return nil, err
+			}
+		}
+		var resp *PDU
+		resp, err = c.transport.send(unit, req, c.Timeout)
+		if err == nil {
+			if resp == nil {
+				return nil, nil
+			}
+			if resp.Function == req.Function|exceptionFlag && len(resp.Data) == 1 {
+				return nil, &ExceptionError{Function: req.Function, Code: ExceptionCode(resp.Data[0])}
+			}
+			if resp.Function == req.Function {
+				return resp, nil
+			}
+			err = ErrInvalidResponse
+		}
+		if !retryable(err) {
+			return nil, err
+		}
+	}
+	return nil, err
+}
+
+func (c *Client) readBits(function byte, unit byte, address, quantity uint16) ([]bool, error) {
+	if quantity < 1 || quantity > MaxReadBits {
+		return nil, ErrInvalidQuantity
+	}
+	resp, err := c.Send(unit, newPDU(function, address, quantity))
+	if err != nil || resp == nil {
+		return nil, err
+	}
+	count := (int(quantity) + 7) / 8
+	if len(resp.Data) != 1+count || int(resp.Data[0]) != count {
+		return nil, ErrInvalidResponse
+	}
+	return unpackBits(resp.Data[1:], int(quantity)), nil
+}
+
+func (c *Client) readRegisters(function byte, unit byte, address, quantity uint16) ([]uint16, error) {
+	if quantity < 1 || quantity > MaxReadRegisters {
+		return nil, ErrInvalidQuantity
+	}
+	resp, err := c.Send(unit, newPDU(function, address, quantity))
+	if err != nil || resp == nil {
+		return nil, err
+	}
+	return checkRegisters(resp, quantity)
+}
+
+func checkRegisters(resp *PDU, quantity uint16) ([]uint16, error) {
+	count := 2 * int(quantity)
+	if len(resp.Data) != 1+count || int(resp.Data[0]) != count {
+		return nil, ErrInvalidResponse
+	}
+	return unpackRegisters(resp.Data[1:]), nil
+}
+
+// checkEcho verifies a write response echoing the first four bytes of the request.
+func checkEcho(req, resp *PDU) error {
+	if resp == nil {
+		return nil
+	}
+	if len(resp.Data) != 4 || string(resp.Data) != string(req.Data[:4]) {
+		return ErrInvalidResponse
+	}
+	return nil
+}
+
+// ReadCoils reads quantity coils (function code 1) starting at address.
+func (c *Client) ReadCoils(unit byte, address, quantity uint16) ([]bool, error) {
+	return c.readBits(FuncReadCoils, unit, address, quantity)
+}
+
+// ReadDiscreteInputs reads quantity discrete inputs (function code 2) starting at address.
+func (c *Client) ReadDiscreteInputs(unit byte, address, quantity uint16) ([]bool, error) {
+	return c.readBits(FuncReadDiscreteInputs, unit, address, quantity)
+}
+
+// ReadHoldingRegisters reads quantity holding registers (function code 3) starting at address.
+func (c *Client) ReadHoldingRegisters(unit byte, address, quantity uint16) ([]uint16, error) {
+	return c.readRegisters(FuncReadHoldingRegisters, unit, address, quantity)
+}
+
+// ReadInputRegisters reads quantity input registers (function code 4) starting at address.
+func (c *Client) ReadInputRegisters(unit byte, address, quantity uint16) ([]uint16, error) {
+	return c.readRegisters(FuncReadInputRegisters, unit, address, quantity)
+}
+
+// WriteSingleCoil writes a single coil (function code 5).
+func (c *Client) WriteSingleCoil(unit byte, address uint16, value bool) error {
+	v := uint16(0x0000)
+	if value {
+		v = 0xFF00
+	}
+	req := newPDU(FuncWriteSingleCoil, address, v)
+	resp, err := c.Send(unit, req)
+	if err != nil {
+		return err
+	}
+	return checkEcho(req, resp)
+}
+
+// WriteSingleRegister writes a single holding register (function code 6).
+func (c *Client) WriteSingleRegister(unit byte, address, value uint16) error {
+	req := newPDU(FuncWriteSingleRegister, address, value)
+	resp, err := c.Send(unit, req)
+	if err != nil {
+		return err
+	}
+	return checkEcho(req, resp)
+}
+
+// WriteMultipleCoils writes consecutive coils (function code 15) starting at address.
+func (c *Client) WriteMultipleCoils(unit byte, address uint16, values []bool) error {
+	if len(values) < 1 || len(values) > MaxWriteBits {
+		return ErrInvalidQuantity
+	}
+	data := packBits(values)
+	req := newPDU(FuncWriteMultipleCoils, address, uint16(len(values)))
+	req.Data = append(append(req.Data, byte(len(data))), data...)
+	resp, err := c.Send(unit, req)
+	if err != nil {
+		return err
+	}
+	return checkEcho(req, resp)
+}
+
+// WriteMultipleRegisters writes consecutive holding registers (function code 16) starting at address.
+func (c *Client) WriteMultipleRegisters(unit byte, address uint16, values []uint16) error {
+	if len(values) < 1 || len(values) > MaxWriteRegisters {
+		return ErrInvalidQuantity
+	}
+	req := newPDU(FuncWriteMultipleRegisters, address, uint16(len(values)))
+	req.Data = append(append(req.Data, byte(2*len(values))), packRegisters(values)...)
+	resp, err := c.Send(unit, req)
+	if err != nil {
+		return err
+	}
+	return checkEcho(req, resp)
+}
+
+// ReadWriteMultipleRegisters writes values starting at writeAddress and then reads
+// readQuantity holding registers starting at readAddress (function code 23).
+func (c *Client) ReadWriteMultipleRegisters(unit byte, readAddress, readQuantity, writeAddress uint16, values []uint16) ([]uint16, error) {
+	if readQuantity < 1 || readQuantity > MaxReadRegisters || len(values) < 1 || len(values) > MaxReadWriteRegisters {
+		return nil, ErrInvalidQuantity
+	}
+	req := newPDU(FuncReadWriteMultipleRegisters, readAddress, readQuantity, writeAddress, uint16(len(values)))
+	req.Data = append(append(req.Data, byte(2*len(values))), packRegisters(values)...)
+	resp, err := c.Send(unit, req)
+	if err != nil || resp == nil {
+		return nil, err
+	}
+	return checkRegisters(resp, readQuantity)
+}
+
+// ReadDeviceIDCode selects the objects returned by ReadDeviceIdentification.
+type ReadDeviceIDCode byte
+
+const (
+	// ReadDeviceIDBasic streams the basic objects, VendorName to MajorMinorRevision.
+	ReadDeviceIDBasic = ReadDeviceIDCode(1)
+	// ReadDeviceIDRegular streams the basic and regular objects.
+	ReadDeviceIDRegular = ReadDeviceIDCode(2)
+	// ReadDeviceIDExtended streams the basic, regular and extended objects.
+	ReadDeviceIDExtended = ReadDeviceIDCode(3)
+	// ReadDeviceIDSpecific reads a single object.
+	ReadDeviceIDSpecific = ReadDeviceIDCode(4)
+)
+
+// Device identification object ids
+const (
+	ObjectVendorName          = byte(0x00)
+	ObjectProductCode         = byte(0x01)
+	ObjectMajorMinorRevision  = byte(0x02)
+	ObjectVendorURL           = byte(0x03)
+	ObjectProductName         = byte(0x04)
+	ObjectModelName           = byte(0x05)
+	ObjectUserApplicationName = byte(0x06)
+)
+
+// DeviceIdentification is the result of ReadDeviceIdentification.
+type DeviceIdentification struct {
+	ConformityLevel byte
+	Objects         map[byte]string
+}
+
+// ReadDeviceIdentification reads the identification objects of a unit
+// (function code 43, MEI type 14) starting at objectID.
+// For the streaming codes, follow-up requests are issued until all objects are read.
+func (c *Client) ReadDeviceIdentification(unit byte, code ReadDeviceIDCode, objectID byte) (*DeviceIdentification, error) {
+	if code < ReadDeviceIDBasic || code > ReadDeviceIDSpecific {
+		return nil, ErrInvalidQuantity
+	}
+	id := &DeviceIdentification{Objects: make(map[byte]string)}
+	for {
+		req := &PDU{Function: FuncEncapsulatedInterface, Data: []byte{meiReadDeviceID, byte(code), objectID}}
+		resp, err := c.Send(unit, req)
+		if err != nil || resp == nil {
+			return nil, err
+		}
+		// MEI type, read device id code, conformity level, more follows, next object id, number of objects.
+		data := resp.Data
+		if len(data) < 6 || data[0] != meiReadDeviceID || data[1] != byte(code) {
+			return nil, ErrInvalidResponse
+		}
+		id.ConformityLevel = data[2]
+		more, next, count := data[3], data[4], int(data[5])
+		data = data[6:]
+		for i := 0; i < count; i++ {
+			if len(data) < 2 || len(data) < 2+int(data[1]) {
+				return nil, ErrInvalidResponse
+			}
+			n := 2 + int(data[1])
+			id.Objects[data[0]] = string(data[2:n])
+			data = data[n:]
+		}
+		if more != 0xFF || code == ReadDeviceIDSpecific {
+			return id, nil
+		}
+		if next <= objectID {
+			return nil, ErrInvalidResponse
+		}
+		objectID = next
+	}
+}
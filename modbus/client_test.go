@@ -0,0 +1,285 @@
+package modbus
+
+import (
+	"bytes"
+	"errors"
+	serial "github.com/daedaluz/goserial"
+	"github.com/daedaluz/goserial/internal/ptytest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCRC16(t *testing.T) {
+	// Read Holding Registers request from the specification examples.
+	if crc := CRC16([]byte{0x01, 0x03, 0x00, 0x00, 0x00, 0x0A}); crc != 0xCDC5 {
+		t.Fatalf("got %#04x, want 0xcdc5", crc)
+	}
+}
+
+func newClient(t *testing.T, port *serial.Port) *Client {
+	t.Helper()
+	client, err := NewRTUClient(port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Timeout = 500 * time.Millisecond
+	return client
+}
+
+// rtuFrame appends the CRC to adu.
+func rtuFrame(adu ...byte) []byte {
+	crc := CRC16(adu)
+	return append(adu, byte(crc), byte(crc>>8))
+}
+
+// exchange is a request ADU the client is expected to send and the response ADU
+// to answer it with, both without CRC. Broadcasts have no response.
+type exchange struct {
+	req, resp []byte
+}
+
+// startDevice answers the exchanges in order on port.
+// The returned channel is closed once all were answered or one failed.
+func startDevice(t *testing.T, port *serial.Port, exchanges ...exchange) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i, e := range exchanges {
+			req := readRequest(t, port)
+			if !bytes.Equal(req, rtuFrame(e.req...)) {
+				t.Errorf("request %d: got % x, want % x", i, req, rtuFrame(e.req...))
+				return
+			}
+			if e.resp != nil {
+				if _, err := port.Write(rtuFrame(e.resp...)); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}
+	}()
+	return done
+}
+
+func TestClientFunctions(t *testing.T) {
+	master, slave := ptytest.Pair(t)
+	done := startDevice(t, slave,
+		exchange{[]byte{7, 0x05, 0x00, 0x03, 0xFF, 0x00}, []byte{7, 0x05, 0x00, 0x03, 0xFF, 0x00}},
+		exchange{[]byte{7, 0x0F, 0x00, 0x08, 0x00, 0x03, 0x01, 0x05}, []byte{7, 0x0F, 0x00, 0x08, 0x00, 0x03}},
+		exchange{[]byte{7, 0x01, 0x00, 0x00, 0x00, 0x0B}, []byte{7, 0x01, 0x02, 0x08, 0x05}},
+		exchange{[]byte{7, 0x02, 0x00, 0x00, 0x00, 0x03}, []byte{7, 0x02, 0x01, 0x02}},
+		exchange{[]byte{7, 0x06, 0x00, 0x00, 0x01, 0x02}, []byte{7, 0x06, 0x00, 0x00, 0x01, 0x02}},
+		exchange{[]byte{7, 0x10, 0x00, 0x01, 0x00, 0x02, 0x04, 0x03, 0x04, 0x05, 0x06}, []byte{7, 0x10, 0x00, 0x01, 0x00, 0x02}},
+		exchange{[]byte{7, 0x03, 0x00, 0x00, 0x00, 0x03}, []byte{7, 0x03, 0x06, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06}},
+		exchange{[]byte{7, 0x04, 0x00, 0x02, 0x00, 0x01}, []byte{7, 0x04, 0x02, 0xBE, 0xEF}},
+		exchange{[]byte{7, 0x17, 0x00, 0x00, 0x00, 0x02, 0x00, 0x01, 0x00, 0x01, 0x02, 0xAA, 0xAA}, []byte{7, 0x17, 0x04, 0x01, 0x02, 0xAA, 0xAA}},
+		exchange{[]byte{0, 0x06, 0x00, 0x05, 0x0F, 0x0F}, nil},
+	)
+	client := newClient(t, master)
+
+	if err := client.WriteSingleCoil(7, 3, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.WriteMultipleCoils(7, 8, []bool{true, false, true}); err != nil {
+		t.Fatal(err)
+	}
+	coils, err := client.ReadCoils(7, 0, 11)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []bool{false, false, false, true, false, false, false, false, true, false, true}
+	if !reflect.DeepEqual(coils, want) {
+		t.Fatalf("ReadCoils: got %v, want %v", coils, want)
+	}
+	inputs, err := client.ReadDiscreteInputs(7, 0, 3)
+	if err != nil || !reflect.DeepEqual(inputs, []bool{false, true, false}) {
+		t.Fatalf("ReadDiscreteInputs: got %v, %v", inputs, err)
+	}
+
+	if err := client.WriteSingleRegister(7, 0, 0x0102); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.WriteMultipleRegisters(7, 1, []uint16{0x0304, 0x0506}); err != nil {
+		t.Fatal(err)
+	}
+	registers, err := client.ReadHoldingRegisters(7, 0, 3)
+	if err != nil || !reflect.DeepEqual(registers, []uint16{0x0102, 0x0304, 0x0506}) {
+		t.Fatalf("ReadHoldingRegisters: got %x, %v", registers, err)
+	}
+	registers, err = client.ReadInputRegisters(7, 2, 1)
+	if err != nil || registers[0] != 0xBEEF {
+		t.Fatalf("ReadInputRegisters: got %x, %v", registers, err)
+	}
+	registers, err = client.ReadWriteMultipleRegisters(7, 0, 2, 1, []uint16{0xAAAA})
+	if err != nil || !reflect.DeepEqual(registers, []uint16{0x0102, 0xAAAA}) {
+		t.Fatalf("ReadWriteMultipleRegisters: got %x, %v", registers, err)
+	}
+
+	// Broadcasts return without waiting for a response.
+	start := time.Now()
+	if err := client.WriteSingleRegister(0, 5, 0x0F0F); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d >= client.Timeout {
+		t.Fatalf("broadcast returned after %v", d)
+	}
+	<-done
+}
+
+func TestClientException(t *testing.T) {
+	master, slave := ptytest.Pair(t)
+	done := startDevice(t, slave,
+		exchange{[]byte{1, 0x03, 0x00, 0x06, 0x00, 0x04}, []byte{1, 0x83, 0x02}},
+		exchange{[]byte{1, 0x2B, 0x0E, 0x01, 0x00}, []byte{1, 0xAB, 0x01}},
+	)
+	client := newClient(t, master)
+	client.Retries = 2
+
+	_, err := client.ReadHoldingRegisters(1, 6, 4)
+	var exception *ExceptionError
+	if !errors.As(err, &exception) || exception.Function != FuncReadHoldingRegisters {
+		t.Fatalf("got %v, want an ExceptionError", err)
+	}
+	if !errors.Is(err, IllegalDataAddress) {
+		t.Fatalf("got %v, want IllegalDataAddress", err)
+	}
+	// Exceptions are not retried, a retry would not match the next exchange.
+	if _, err := client.ReadDeviceIdentification(1, ReadDeviceIDBasic, 0); !errors.Is(err, IllegalFunction) {
+		t.Fatalf("got %v, want IllegalFunction", err)
+	}
+	<-done
+}
+
+func TestClientTimeout(t *testing.T) {
+	master, _ := ptytest.Pair(t)
+	client := newClient(t, master)
+	client.Timeout = 50 * time.Millisecond
+	client.Retries = 1
+	start := time.Now()
+	_, err := client.ReadCoils(3, 0, 1)
+	if !errors.Is(err, serial.ErrTimeout) {
+		t.Fatalf("got %v, want ErrTimeout", err)
+	}
+	if d := time.Since(start); d < 100*time.Millisecond {
+		t.Fatalf("returned after %v, the request was not retried", d)
+	}
+}
+
+// readRequest reads a request frame written by the client on the other end.
+func readRequest(t *testing.T, port *serial.Port) []byte {
+	t.Helper()
+	buf := make([]byte, maxRTUFrame)
+	n, err := port.ReadTimeout(buf, time.Second)
+	if err != nil {
+		t.Error(err)
+		return nil
+	}
+	for {
+		x, err := port.ReadTimeout(buf[n:], 20*time.Millisecond)
+		if errors.Is(err, serial.ErrTimeout) {
+			return buf[:n]
+		}
+		if err != nil {
+			t.Error(err)
+			return nil
+		}
+		n += x
+	}
+}
+
+func TestClientRetriesCorruptedResponse(t *testing.T) {
+	master, slave := ptytest.Pair(t)
+	client := newClient(t, master)
+	client.Retries = 2
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		response := rtuFrame(4, FuncReadInputRegisters, 2, 0x12, 0x34)
+		corrupted := append([]byte(nil), response...)
+		corrupted[3] ^= 0xFF
+		for _, r := range [][]byte{corrupted, response} {
+			if readRequest(t, slave) == nil {
+				return
+			}
+			slave.Write(r)
+		}
+	}()
+	registers, err := client.ReadInputRegisters(4, 0, 1)
+	<-done
+	if err != nil || registers[0] != 0x1234 {
+		t.Fatalf("got %x, %v", registers, err)
+	}
+}
+
+func TestClientReadDeviceIdentification(t *testing.T) {
+	master, slave := ptytest.Pair(t)
+	client := newClient(t, master)
+
+	responses := [][]byte{
+		// Basic objects split over two responses: more follows, next object 2.
+		rtuFrame(9, FuncEncapsulatedInterface, meiReadDeviceID, 1, 0x81, 0xFF, 0x02, 2,
+			ObjectVendorName, 4, 'A', 'c', 'm', 'e',
+			ObjectProductCode, 2, 'P', '1'),
+		rtuFrame(9, FuncEncapsulatedInterface, meiReadDeviceID, 1, 0x81, 0x00, 0x00, 1,
+			ObjectMajorMinorRevision, 3, '1', '.', '0'),
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i, r := range responses {
+			req := readRequest(t, slave)
+			if len(req) != 7 || req[4] != byte(2*i) {
+				t.Errorf("request %d: % x", i, req)
+				return
+			}
+			slave.Write(r)
+		}
+	}()
+	id, err := client.ReadDeviceIdentification(9, ReadDeviceIDBasic, 0)
+	<-done
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[byte]string{ObjectVendorName: "Acme", ObjectProductCode: "P1", ObjectMajorMinorRevision: "1.0"}
+	if id.ConformityLevel != 0x81 || !reflect.DeepEqual(id.Objects, want) {
+		t.Fatalf("got %#x %v", id.ConformityLevel, id.Objects)
+	}
+}
+
+// fakeTransport returns canned responses, without any framing limits.
+type fakeTransport []*PDU
+
+func (f *fakeTransport) send(unit byte, req *PDU, timeout time.Duration) (*PDU, error) {
+	resp := (*f)[0]
+	*f = (*f)[1:]
+	return resp, nil
+}
+
+func (f *fakeTransport) flush() error {
+	return nil
+}
+
+func TestClientReadDeviceIdentificationLongObjects(t *testing.T) {
+	for _, size := range []int{254, 255} {
+		value := bytes.Repeat([]byte{'x'}, size)
+		data := append([]byte{meiReadDeviceID, byte(ReadDeviceIDExtended), 0x83, 0x00, 0x00, 2,
+			0x80, byte(size)}, value...)
+		data = append(data, 0x81, 1, 'y')
+		client := &Client{transport: &fakeTransport{{Function: FuncEncapsulatedInterface, Data: data}}}
+		id, err := client.ReadDeviceIdentification(1, ReadDeviceIDExtended, 0x80)
+		if err != nil {
+			t.Fatalf("%d bytes: %v", size, err)
+		}
+		if id.Objects[0x80] != string(value) || id.Objects[0x81] != "y" {
+			t.Fatalf("%d bytes: got %q", size, id.Objects)
+		}
+
+		// The same object cut short.
+		client.transport = &fakeTransport{{Function: FuncEncapsulatedInterface, Data: data[:8+size-1]}}
+		if _, err := client.ReadDeviceIdentification(1, ReadDeviceIDExtended, 0x80); err != ErrInvalidResponse {
+			t.Fatalf("%d bytes truncated: got %v, want %v", size, err, ErrInvalidResponse)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+// Package modbus implements Modbus RTU and ASCII on top of serial.Port.
+package modbus
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Function codes
+const (
+	FuncReadCoils                  = byte(0x01)
+	FuncReadDiscreteInputs         = byte(0x02)
+	FuncReadHoldingRegisters       = byte(0x03)
+	FuncReadInputRegisters         = byte(0x04)
+	FuncWriteSingleCoil            = byte(0x05)
+	FuncWriteSingleRegister        = byte(0x06)
+	FuncWriteMultipleCoils         = byte(0x0F)
+	FuncWriteMultipleRegisters     = byte(0x10)
+	FuncReadWriteMultipleRegisters = byte(0x17)
+	FuncEncapsulatedInterface      = byte(0x2B)
+
+	// exceptionFlag is set in the function code of exception responses.
+	exceptionFlag = byte(0x80)
+
+	// meiReadDeviceID is the MEI type of Read Device Identification.
+	meiReadDeviceID = byte(0x0E)
+)
+
+// Quantity limits per request
+const (
+	MaxReadBits       = 2000
+	MaxReadRegisters  = 125
+	MaxWriteBits      = 1968
+	MaxWriteRegisters = 123
+	// MaxReadWriteRegisters is the write limit of ReadWriteMultipleRegisters.
+	MaxReadWriteRegisters = 121
+)
+
+// ExceptionCode is the reason reported in an exception response.
+type ExceptionCode byte
+
+const (
+	IllegalFunction                    = ExceptionCode(0x01)
+	IllegalDataAddress                 = ExceptionCode(0x02)
+	IllegalDataValue                   = ExceptionCode(0x03)
+	ServerDeviceFailure                = ExceptionCode(0x04)
+	Acknowledge                        = ExceptionCode(0x05)
+	ServerDeviceBusy                   = ExceptionCode(0x06)
+	MemoryParityError                  = ExceptionCode(0x08)
+	GatewayPathUnavailable             = ExceptionCode(0x0A)
+	GatewayTargetDeviceFailedToRespond = ExceptionCode(0x0B)
+)
+
+var exceptionStrings = map[ExceptionCode]string{
+	IllegalFunction:                    "illegal function",
+	IllegalDataAddress:                 "illegal data address",
+	IllegalDataValue:                   "illegal data value",
+	ServerDeviceFailure:                "server device failure",
+	Acknowledge:                        "acknowledge",
+	ServerDeviceBusy:                   "server device busy",
+	MemoryParityError:                  "memory parity error",
+	GatewayPathUnavailable:             "gateway path unavailable",
+	GatewayTargetDeviceFailedToRespond: "gateway target device failed to respond",
+}
+
+func (e ExceptionCode) Error() string {
+	if s, ok := exceptionStrings[e]; ok {
+		return s
+	}
+	return fmt.Sprintf("exception %d", byte(e))
+}
+
+// ExceptionError is returned when a unit answers with an exception response.
+// It unwraps to its ExceptionCode, so errors.Is(err, IllegalDataAddress) works.
+type ExceptionError struct {
+	Function byte
+	Code     ExceptionCode
+}
+
+func (e *ExceptionError) Error() string {
+	return fmt.Sprintf("modbus: function 0x%02x: %s", e.Function, e.Code.Error())
+}
+
+func (e *ExceptionError) Unwrap() error {
+	return e.Code
+}
+
+var (
+	ErrCRC             = errors.New("modbus: checksum mismatch")
+	ErrInvalidResponse = errors.New("modbus: invalid response")
+	ErrInvalidQuantity = errors.New("modbus: invalid quantity")
+	ErrFrameTooLong    = errors.New("modbus: frame too long")
+	ErrInvalidFrame    = errors.New("modbus: invalid frame")
+)
+
+// PDU is a Modbus protocol data unit: a function code and its data.
+type PDU struct {
+	Function byte
+	Data     []byte
+}
+
+func newPDU(function byte, fields ...uint16) *PDU {
+	pdu := &PDU{Function: function, Data: make([]byte, 0, 2*len(fields))}
+	for _, f := range fields {
+		pdu.Data = append(pdu.Data, byte(f>>8), byte(f))
+	}
+	return pdu
+}
+
+// packBits packs bools into bytes, least significant bit first.
+func packBits(values []bool) []byte {
+	data := make([]byte, (len(values)+7)/8)
+	for i, v := range values {
+		if v {
+			data[i/8] |= 1 << (i % 8)
+		}
+	}
+	return data
+}
+
+// unpackBits unpacks quantity bools from bytes, least significant bit first.
+func unpackBits(data []byte, quantity int) []bool {
+	values := make([]bool, quantity)
+	for i := range values {
+		values[i] = data[i/8]&(1<<(i%8)) != 0
+	}
+	return values
+}
+
+func packRegisters(values []uint16) []byte {
+	data := make([]byte, 0, 2*len(values))
+	for _, v := range values {
+		data = append(data, byte(v>>8), byte(v))
+	}
+	return data
+}
+
+func unpackRegisters(data []byte) []uint16 {
+	values := make([]uint16, len(data)/2)
+	for i := range values {
+		values[i] = binary.BigEndian.Uint16(data[2*i:])
+	}
+	return values
+}
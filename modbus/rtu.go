@@ -0,0 +1,238 @@
+package modbus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	serial "github.com/daedaluz/goserial"
+	"io"
+	"time"
+)
+
+const (
+	// maxRTUFrame is the maximum size of an RTU ADU.
+	maxRTUFrame = 256
+
+	// maxFrameGap is the longest pause tolerated within a frame of known length.
+	maxFrameGap = 100 * time.Millisecond
+)
+
+// FrameSilence returns the minimum silence between RTU frames, 3.5 character
+// times of 11 bits, at the given baud rate. Above 19200 baud the fixed value
+// of 1.75ms recommended by the specification is used.
+func FrameSilence(baud uint32) time.Duration {
+	if baud > 19200 {
+		return 1750 * time.Microsecond
+	}
+	return time.Duration(35*11) * time.Second / time.Duration(10*baud)
+}
+
+// rtuTransport frames PDUs as RTU ADUs: the unit id, the PDU and a CRC-16,
+// separated by at least 3.5 characters of silence.
+type rtuTransport struct {
+	port    *serial.Port
+	silence time.Duration
+	// last is when the line was last seen busy.
+	last time.Time
+}
+
+func newRTUTransport(port *serial.Port) (*rtuTransport, error) {
+	attrs, err := port.GetAttr2()
+	if err != nil {
+		return nil, err
+	}
+	baud := attrs.Speed()
+	if baud == 0 {
+		return nil, fmt.Errorf("modbus: port has no baud rate set")
+	}
+	return &rtuTransport{port: port, silence: FrameSilence(baud)}, nil
+}
+
+func (t *rtuTransport) writeFrame(unit byte, pdu *PDU) error {
+	adu := make([]byte, 0, len(pdu.Data)+4)
+	adu = append(adu, unit, pdu.Function)
+	adu = append(adu, pdu.Data...)
+	if len(adu)+2 > maxRTUFrame {
+		return ErrFrameTooLong
+	}
+	crc := CRC16(adu)
+	adu = append(adu, byte(crc), byte(crc>>8))
+	if d := time.Until(t.last.Add(t.silence)); d > 0 {
+		time.Sleep(d)
+	}
+	if _, err := t.port.Write(adu); err != nil {
+		return err
+	}
+	err := t.port.Drain()
+	t.last = time.Now()
+	return err
+}
+
+// readFrame reads a single frame and verifies its CRC.
+//
+// The first byte is awaited until ctx is done or the timeout expires, a negative
+// timeout waits forever. The length function is called with the bytes read so far
+// and returns the length of the frame, -1 if more bytes are needed to tell,
+// or 0 if the length cannot be told, in which case the frame ends at the first silence.
+func (t *rtuTransport) readFrame(ctx context.Context, timeout time.Duration, length func([]byte) int) ([]byte, error) {
+	buf := make([]byte, maxRTUFrame)
+	n := 0
+	var deadline time.Time
+	if timeout > -1 {
+		deadline = time.Now().Add(timeout)
+	}
+	for {
+		want := length(buf[:n])
+		if want > maxRTUFrame {
+			return nil, ErrFrameTooLong
+		}
+		if want > 0 && n >= want {
+			break
+		}
+		end := len(buf)
+		if want > 0 {
+			end = want
+		}
+		if n == end {
+			return nil, ErrFrameTooLong
+		}
+		var x int
+		var err error
+		switch {
+		case n == 0 && ctx.Done() != nil:
+			if !deadline.IsZero() {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithDeadline(ctx, deadline)
+				defer cancel()
+			}
+			x, err = t.port.ReadContext(ctx, buf[n:end])
+		case n == 0 && !deadline.IsZero():
+			wait := time.Until(deadline)
+			if wait <= 0 {
+				return nil, serial.ErrTimeout
+			}
+			x, err = t.port.ReadTimeout(buf[n:end], wait)
+		case n == 0:
+			x, err = t.port.Read(buf[n:end])
+		default:
+			// Within a frame of unknown length, a silence of 3.5 characters ends it.
+			// When the length is known, tolerate the gaps USB adapters tend to introduce.
+			wait := t.silence
+			if want != 0 {
+				wait = maxFrameGap
+				if d := time.Until(deadline); !deadline.IsZero() && d > wait {
+					wait = d
+				}
+			}
+			x, err = t.port.ReadTimeout(buf[n:end], wait)
+			if errors.Is(err, serial.ErrTimeout) {
+				if want == 0 {
+					n += x
+					return t.checkFrame(buf[:n])
+				}
+				return nil, io.ErrUnexpectedEOF
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		if x == 0 {
+			return nil, io.ErrUnexpectedEOF
+		}
+		n += x
+		t.last = time.Now()
+	}
+	return t.checkFrame(buf[:n])
+}
+
+func (t *rtuTransport) checkFrame(adu []byte) ([]byte, error) {
+	if len(adu) < 4 {
+		return nil, io.ErrUnexpectedEOF
+	}
+	crc := CRC16(adu[:len(adu)-2])
+	if adu[len(adu)-2] != byte(crc) || adu[len(adu)-1] != byte(crc>>8) {
+		return nil, ErrCRC
+	}
+	return adu[:len(adu)-2], nil
+}
+
+func (t *rtuTransport) send(unit byte, req *PDU, timeout time.Duration) (*PDU, error) {
+	if err := t.writeFrame(unit, req); err != nil {
+		return nil, err
+	}
+	if unit == 0 {
+		// Broadcasts are not answered.
+		return nil, nil
+	}
+	adu, err := t.readFrame(context.Background(), timeout, responseLength)
+	if err != nil {
+		return nil, err
+	}
+	if adu[0] != unit {
+		return nil, ErrInvalidResponse
+	}
+	return &PDU{Function: adu[1], Data: adu[2:]}, nil
+}
+
+// flush discards input once the line has been silent for a frame gap,
+// so that a late or corrupted response does not spill into the next one.
+func (t *rtuTransport) flush() error {
+	buf := make([]byte, maxRTUFrame)
+	for {
+		_, err := t.port.ReadTimeout(buf, t.silence)
+		if errors.Is(err, serial.ErrTimeout) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		t.last = time.Now()
+	}
+}
+
+// responseLength returns the length of the response ADU in adu, see readFrame.
+func responseLength(adu []byte) int {
+	if len(adu) < 2 {
+		return -1
+	}
+	function := adu[1]
+	if function&exceptionFlag != 0 {
+		return 5
+	}
+	switch function {
+	case FuncReadCoils, FuncReadDiscreteInputs, FuncReadHoldingRegisters, FuncReadInputRegisters,
+		FuncReadWriteMultipleRegisters:
+		if len(adu) < 3 {
+			return -1
+		}
+		return 3 + int(adu[2]) + 2
+	case FuncWriteSingleCoil, FuncWriteSingleRegister, FuncWriteMultipleCoils, FuncWriteMultipleRegisters:
+		return 8
+	case FuncEncapsulatedInterface:
+		return deviceIDResponseLength(adu)
+	}
+	return 0
+}
+
+func deviceIDResponseLength(adu []byte) int {
+	// unit, function, MEI type, read device id code, conformity level,
+	// more follows, next object id and number of objects.
+	const header = 8
+	if len(adu) < 3 {
+		return -1
+	}
+	if adu[2] != meiReadDeviceID {
+		return 0
+	}
+	if len(adu) < header {
+		return -1
+	}
+	n := header
+	for i := 0; i < int(adu[7]); i++ {
+		if len(adu) < n+2 {
+			return -1
+		}
+		n += 2 + int(adu[n+1])
+	}
+	return n + 2
+}
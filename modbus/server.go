@@ -0,0 +1,333 @@
+package modbus
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	serial "github.com/daedaluz/goserial"
+	"io"
+	"sync"
+)
+
+// Handler serves the data model of a unit.
+// Returning an ExceptionCode as error answers the request with that exception,
+// any other error is answered with ServerDeviceFailure.
+type Handler interface {
+	ReadCoils(unit byte, address, quantity uint16) ([]bool, error)
+	ReadDiscreteInputs(unit byte, address, quantity uint16) ([]bool, error)
+	ReadHoldingRegisters(unit byte, address, quantity uint16) ([]uint16, error)
+	ReadInputRegisters(unit byte, address, quantity uint16) ([]uint16, error)
+	WriteCoils(unit byte, address uint16, values []bool) error
+	WriteHoldingRegisters(unit byte, address uint16, values []uint16) error
+}
+
+// serverTransport reads request PDUs and writes response PDUs.
+type serverTransport interface {
+	// readRequest reads the next frame on the line, which may be for another unit.
+	readRequest(ctx context.Context, unit byte) (byte, *PDU, error)
+	writeResponse(unit byte, resp *PDU) error
+	// flush discards pending input to resynchronise after a bad frame.
+	flush() error
+}
+
+// Server is a Modbus slave answering requests for a single unit id.
+// Requests for other units are ignored, broadcasts (unit 0) are handled without responding.
+type Server struct {
+	unit      byte
+	handler   Handler
+	transport serverTransport
+}
+
+// NewRTUServer returns a Modbus RTU Server on port answering for unit.
+// The frame silence is computed from the baud rate the port is configured with.
+func NewRTUServer(port *serial.Port, unit byte, handler Handler) (*Server, error) {
+	t, err := newRTUTransport(port)
+	if err != nil {
+		return nil, err
+	}
+	return &Server{unit: unit, handler: handler, transport: t}, nil
+}
+
+func (t *rtuTransport) readRequest(ctx context.Context, unit byte) (byte, *PDU, error) {
+	// Frames for other units may be responses, which requestLength would misjudge
+	// and make us wait past the end of the frame into the next one, so they end
+	// at the first silence instead.
+	length := func(adu []byte) int {
+		if len(adu) > 0 && adu[0] != unit && adu[0] != 0 {
+			return 0
+		}
+		return requestLength(adu)
+	}
+	adu, err := t.readFrame(ctx, -1, length)
+	if err != nil {
+		return 0, nil, err
+	}
+	return adu[0], &PDU{Function: adu[1], Data: adu[2:]}, nil
+}
+
+func (t *rtuTransport) writeResponse(unit byte, resp *PDU) error {
+	return t.writeFrame(unit, resp)
+}
+
+// requestLength returns the length of the request ADU in adu, see readFrame.
+func requestLength(adu []byte) int {
+	if len(adu) < 2 {
+		return -1
+	}
+	switch adu[1] {
+	case FuncReadCoils, FuncReadDiscreteInputs, FuncReadHoldingRegisters, FuncReadInputRegisters,
+		FuncWriteSingleCoil, FuncWriteSingleRegister:
+		return 8
+	case FuncWriteMultipleCoils, FuncWriteMultipleRegisters:
+		if len(adu) < 7 {
+			return -1
+		}
+		return 7 + int(adu[6]) + 2
+	case FuncReadWriteMultipleRegisters:
+		if len(adu) < 11 {
+			return -1
+		}
+		return 11 + int(adu[10]) + 2
+	case FuncEncapsulatedInterface:
+		return 7
+	}
+	return 0
+}
+
+// frameError returns true for errors caused by a corrupted or foreign frame on the line.
+func frameError(err error) bool {
+	return errors.Is(err, serial.ErrTimeout) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		err == ErrCRC || err == ErrFrameTooLong || err == ErrInvalidFrame
+}
+
+// Serve answers requests until ctx is done or the port fails.
+func (s *Server) Serve(ctx context.Context) error {
+	for {
+		unit, req, err := s.transport.readRequest(ctx, s.unit)
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err != nil {
+			if !frameError(err) {
+				return err
+			}
+			if err := s.transport.flush(); err != nil {
+				return err
+			}
+			continue
+		}
+		if unit != s.unit && unit != 0 {
+			continue
+		}
+		resp := s.handle(unit, req)
+		if unit == 0 {
+			continue
+		}
+		if err := s.transport.writeResponse(unit, resp); err != nil {
+			return err
+		}
+	}
+}
+
+func exception(function byte, err error) *PDU {
+	code := ServerDeviceFailure
+	errors.As(err, &code)
+	return &PDU{Function: function | exceptionFlag, Data: []byte{byte(code)}}
+}
+
+// handle dispatches a request to the handler and returns the response.
+func (s *Server) handle(unit byte, req *PDU) *PDU {
+	data := req.Data
+	field := func(i int) uint16 {
+		return binary.BigEndian.Uint16(data[2*i:])
+	}
+	switch req.Function {
+	case FuncReadCoils, FuncReadDiscreteInputs:
+		if len(data) != 4 || field(1) < 1 || field(1) > MaxReadBits {
+			return exception(req.Function, IllegalDataValue)
+		}
+		address, quantity := field(0), field(1)
+		if int(address)+int(quantity) > 0x10000 {
+			return exception(req.Function, IllegalDataAddress)
+		}
+		read := s.handler.ReadCoils
+		if req.Function == FuncReadDiscreteInputs {
+			read = s.handler.ReadDiscreteInputs
+		}
+		values, err := read(unit, address, quantity)
+		if err == nil && len(values) != int(quantity) {
+			err = ServerDeviceFailure
+		}
+		if err != nil {
+			return exception(req.Function, err)
+		}
+		bits := packBits(values)
+		return &PDU{Function: req.Function, Data: append([]byte{byte(len(bits))}, bits...)}
+
+	case FuncReadHoldingRegisters, FuncReadInputRegisters:
+		if len(data) != 4 || field(1) < 1 || field(1) > MaxReadRegisters {
+			return exception(req.Function, IllegalDataValue)
+		}
+		address, quantity := field(0), field(1)
+		if int(address)+int(quantity) > 0x10000 {
+			return exception(req.Function, IllegalDataAddress)
+		}
+		read := s.handler.ReadHoldingRegisters
+		if req.Function == FuncReadInputRegisters {
+			read = s.handler.ReadInputRegisters
+		}
+		values, err := read(unit, address, quantity)
+		return registersResponse(req.Function, values, quantity, err)
+
+	case FuncWriteSingleCoil:
+		if len(data) != 4 || (field(1) != 0x0000 && field(1) != 0xFF00) {
+			return exception(req.Function, IllegalDataValue)
+		}
+		if err := s.handler.WriteCoils(unit, field(0), []bool{field(1) == 0xFF00}); err != nil {
+			return exception(req.Function, err)
+		}
+		return &PDU{Function: req.Function, Data: data}
+
+	case FuncWriteSingleRegister:
+		if len(data) != 4 {
+			return exception(req.Function, IllegalDataValue)
+		}
+		if err := s.handler.WriteHoldingRegisters(unit, field(0), []uint16{field(1)}); err != nil {
+			return exception(req.Function, err)
+		}
+		return &PDU{Function: req.Function, Data: data}
+
+	case FuncWriteMultipleCoils:
+		if len(data) < 5 || field(1) < 1 || field(1) > MaxWriteBits ||
+			int(data[4]) != (int(field(1))+7)/8 || len(data) != 5+int(data[4]) {
+			return exception(req.Function, IllegalDataValue)
+		}
+		address, quantity := field(0), field(1)
+		if int(address)+int(quantity) > 0x10000 {
+			return exception(req.Function, IllegalDataAddress)
+		}
+		if err := s.handler.WriteCoils(unit, address, unpackBits(data[5:], int(quantity))); err != nil {
+			return exception(req.Function, err)
+		}
+		return &PDU{Function: req.Function, Data: data[:4]}
+
+	case FuncWriteMultipleRegisters:
+		if len(data) < 5 || field(1) < 1 || field(1) > MaxWriteRegisters ||
+			int(data[4]) != 2*int(field(1)) || len(data) != 5+int(data[4]) {
+			return exception(req.Function, IllegalDataValue)
+		}
+		address, quantity := field(0), field(1)
+		if int(address)+int(quantity) > 0x10000 {
+			return exception(req.Function, IllegalDataAddress)
+		}
+		if err := s.handler.WriteHoldingRegisters(unit, address, unpackRegisters(data[5:])); err != nil {
+			return exception(req.Function, err)
+		}
+		return &PDU{Function: req.Function, Data: data[:4]}
+
+	case FuncReadWriteMultipleRegisters:
+		if len(data) < 9 || field(1) < 1 || field(1) > MaxReadRegisters ||
+			field(3) < 1 || field(3) > MaxReadWriteRegisters ||
+			int(data[8]) != 2*int(field(3)) || len(data) != 9+int(data[8]) {
+			return exception(req.Function, IllegalDataValue)
+		}
+		readAddress, readQuantity, writeAddress, writeQuantity := field(0), field(1), field(2), field(3)
+		if int(readAddress)+int(readQuantity) > 0x10000 || int(writeAddress)+int(writeQuantity) > 0x10000 {
+			return exception(req.Function, IllegalDataAddress)
+		}
+		if err := s.handler.WriteHoldingRegisters(unit, writeAddress, unpackRegisters(data[9:])); err != nil {
+			return exception(req.Function, err)
+		}
+		values, err := s.handler.ReadHoldingRegisters(unit, readAddress, readQuantity)
+		return registersResponse(req.Function, values, readQuantity, err)
+	}
+	return exception(req.Function, IllegalFunction)
+}
+
+func registersResponse(function byte, values []uint16, quantity uint16, err error) *PDU {
+	if err == nil && len(values) != int(quantity) {
+		err = ServerDeviceFailure
+	}
+	if err != nil {
+		return exception(function, err)
+	}
+	return &PDU{Function: function, Data: append([]byte{byte(2 * len(values))}, packRegisters(values)...)}
+}
+
+// Memory is a Handler backed by plain slices, serving the same data to every unit.
+// Accesses outside the slices are answered with IllegalDataAddress.
+type Memory struct {
+	mu               sync.Mutex
+	Coils            []bool
+	DiscreteInputs   []bool
+	HoldingRegisters []uint16
+	InputRegisters   []uint16
+}
+
+// NewMemory returns a Memory with size entries in each table.
+func NewMemory(size int) *Memory {
+	return &Memory{
+		Coils:            make([]bool, size),
+		DiscreteInputs:   make([]bool, size),
+		HoldingRegisters: make([]uint16, size),
+		InputRegisters:   make([]uint16, size),
+	}
+}
+
+func readBits(table []bool, address, quantity uint16) ([]bool, error) {
+	if int(address)+int(quantity) > len(table) {
+		return nil, IllegalDataAddress
+	}
+	return append([]bool(nil), table[address:int(address)+int(quantity)]...), nil
+}
+
+func readRegisters(table []uint16, address, quantity uint16) ([]uint16, error) {
+	if int(address)+int(quantity) > len(table) {
+		return nil, IllegalDataAddress
+	}
+	return append([]uint16(nil), table[address:int(address)+int(quantity)]...), nil
+}
+
+func (m *Memory) ReadCoils(unit byte, address, quantity uint16) ([]bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return readBits(m.Coils, address, quantity)
+}
+
+func (m *Memory) ReadDiscreteInputs(unit byte, address, quantity uint16) ([]bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return readBits(m.DiscreteInputs, address, quantity)
+}
+
+func (m *Memory) ReadHoldingRegisters(unit byte, address, quantity uint16) ([]uint16, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return readRegisters(m.HoldingRegisters, address, quantity)
+}
+
+func (m *Memory) ReadInputRegisters(unit byte, address, quantity uint16) ([]uint16, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return readRegisters(m.InputRegisters, address, quantity)
+}
+
+func (m *Memory) WriteCoils(unit byte, address uint16, values []bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if int(address)+len(values) > len(m.Coils) {
+		return IllegalDataAddress
+	}
+	copy(m.Coils[address:], values)
+	return nil
+}
+
+func (m *Memory) WriteHoldingRegisters(unit byte, address uint16, values []uint16) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if int(address)+len(values) > len(m.HoldingRegisters) {
+		return IllegalDataAddress
+	}
+	copy(m.HoldingRegisters[address:], values)
+	return nil
+}
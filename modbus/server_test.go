@@ -0,0 +1,63 @@
+package modbus
+
+import (
+	"context"
+	serial "github.com/daedaluz/goserial"
+	"github.com/daedaluz/goserial/internal/ptytest"
+	"testing"
+	"time"
+)
+
+// startServer serves handler for unit on port until the test ends.
+func startServer(t *testing.T, port *serial.Port, unit byte, handler Handler) {
+	t.Helper()
+	server, err := NewRTUServer(port, unit, handler)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- server.Serve(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-done; err != context.Canceled {
+			t.Errorf("Serve: %v", err)
+		}
+	})
+}
+
+func TestServerSkipsOtherUnitsResponses(t *testing.T) {
+	master, slave := ptytest.Pair(t)
+	memory := NewMemory(16)
+	memory.HoldingRegisters[3] = 0x1234
+	startServer(t, slave, 1, memory)
+
+	// A Write Multiple Registers response from unit 2 looks like the start of a
+	// request with a byte count taken from its CRC, pick one where that is large.
+	var response []byte
+	for quantity := byte(1); ; quantity++ {
+		response = rtuFrame(2, FuncWriteMultipleRegisters, 0x00, 0x10, 0x00, quantity)
+		if requestLength(response) > len(response)+16 {
+			break
+		}
+	}
+	if _, err := master.Write(response); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	client, err := NewRTUClient(master)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Timeout = 500 * time.Millisecond
+	values, err := client.ReadHoldingRegisters(1, 3, 1)
+	if err != nil {
+		t.Fatalf("request after another unit's response: %v", err)
+	}
+	if values[0] != 0x1234 {
+		t.Fatalf("got %#x, want 0x1234", values[0])
+	}
+}
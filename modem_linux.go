@@ -0,0 +1,235 @@
+package serial
+
+import (
+	"context"
+	"errors"
+	ioctl "github.com/daedaluz/goioctl"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// ModemPollInterval is how often modem lines are polled on ports whose
+// driver does not support TIOCMIWAIT.
+var ModemPollInterval = 50 * time.Millisecond
+
+// modemWaitLines are the input lines TIOCMIWAIT can wait for.
+const modemWaitLines = TIOCM_RNG | TIOCM_DSR | TIOCM_CD | TIOCM_CTS
+
+// WaitModemChange waits until one of the input lines in mask (TIOCM_RNG, TIOCM_DSR,
+// TIOCM_CD and TIOCM_CTS) changes, and returns the modem lines after the change.
+//
+// TIOCMIWAIT cannot be interrupted and keeps the port open until a line changes,
+// so it is only used when ctx can never be cancelled and the driver supports it.
+// Otherwise the lines are polled every ModemPollInterval, along with the transition
+// counters of TIOCGICOUNT where available, so that pulses shorter than the interval are not missed.
+//
+// Pseudo-terminals support neither TIOCMIWAIT nor TIOCMGET. The polling fallback reads their
+// lines as all clear, so WaitModemChange only returns once ctx is done. With a ctx that can never
+// be cancelled it fails with ENOTTY instead of waiting forever.
+func (p *Port) WaitModemChange(ctx context.Context, mask ModemLine) (ModemLine, error) {
+	state, err := p.modemState()
+	if err != nil {
+		return 0, wrapErr("WaitModemChange", err)
+	}
+	err = p.waitModemChange(ctx, mask, state)
+	if err != nil {
+		return 0, wrapErr("WaitModemChange", err)
+	}
+	return state.lines, nil
+}
+
+// modemState is the last seen state of the modem lines.
+type modemState struct {
+	lines ModemLine
+	// counters is nil if the driver does not support TIOCGICOUNT.
+	counters *Counters
+	// noLines is set for terminals without modem lines, such as pseudo-terminals.
+	noLines bool
+}
+
+func (p *Port) modemState() (*modemState, error) {
+	lines, err := p.GetModemLines()
+	if errors.Is(err, syscall.ENOTTY) {
+		// A terminal without modem lines, rather than no terminal at all.
+		if _, attrErr := p.GetAttr(); attrErr == nil {
+			return &modemState{noLines: true}, nil
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	counters, _ := p.Counters()
+	return &modemState{lines: lines, counters: counters}, nil
+}
+
+// changed returns true if a line in mask differs from s, or has seen
+// transitions according to the counters, and updates s.
+func (s *modemState) changed(mask, lines ModemLine, counters *Counters) bool {
+	changed := (lines^s.lines)&mask != 0
+	if s.counters != nil && counters != nil {
+		d := counters.Delta(s.counters)
+		changed = changed ||
+			mask&TIOCM_CTS != 0 && d.CTS != 0 ||
+			mask&TIOCM_DSR != 0 && d.DSR != 0 ||
+			mask&TIOCM_RNG != 0 && d.RNG != 0 ||
+			mask&TIOCM_CD != 0 && d.DCD != 0
+	}
+	s.lines = lines
+	if counters != nil {
+		s.counters = counters
+	}
+	return changed
+}
+
+// waitModemChange waits for a change of the lines in mask since state was taken, and updates state.
+func (p *Port) waitModemChange(ctx context.Context, mask ModemLine, state *modemState) error {
+	mask &= modemWaitLines
+	if mask == 0 {
+		return syscall.EINVAL
+	}
+	if ctx.Done() == nil && state.noLines {
+		return syscall.ENOTTY
+	}
+	if ctx.Done() == nil {
+		// Changes since state was taken are not seen by TIOCMIWAIT.
+		if err := p.pollModemLines(mask, state); err != errNoModemChange {
+			return err
+		}
+		err := ioctl.Ioctl(uintptr(p.f.Load().(int)), tiocmiwait, uintptr(mask))
+		switch err {
+		case nil:
+			lines, err := p.GetModemLines()
+			if err != nil {
+				return err
+			}
+			counters, _ := p.Counters()
+			state.changed(mask, lines, counters)
+			return nil
+		case syscall.ENOTTY, syscall.EINVAL:
+		default:
+			return err
+		}
+	}
+	ticker := time.NewTicker(ModemPollInterval)
+	defer ticker.Stop()
+	for {
+		if err := p.pollModemLines(mask, state); err != errNoModemChange {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+var errNoModemChange = errors.New("no modem change")
+
+// pollModemLines reads the modem lines and counters once, and returns errNoModemChange
+// if none of the lines in mask changed since state was taken.
+func (p *Port) pollModemLines(mask ModemLine, state *modemState) error {
+	if state.noLines {
+		return errNoModemChange
+	}
+	lines, err := p.GetModemLines()
+	if err != nil {
+		return err
+	}
+	var counters *Counters
+	if state.counters != nil {
+		counters, _ = p.Counters()
+	}
+	if !state.changed(mask, lines, counters) {
+		return errNoModemChange
+	}
+	return nil
+}
+
+// ModemChange is a change on the modem lines reported by a ModemWatcher.
+// Before and After may be equal if a line pulsed, such as RI.
+type ModemChange struct {
+	Before ModemLine
+	After  ModemLine
+}
+
+// Changed returns the lines that differ between Before and After.
+func (c ModemChange) Changed() ModemLine {
+	return c.Before ^ c.After
+}
+
+// ModemWatcher reports changes on the modem input lines of a Port.
+type ModemWatcher struct {
+	changes chan ModemChange
+	cancel  context.CancelFunc
+	done    chan struct{}
+	err     error
+
+	closeOnce sync.Once
+}
+
+// WatchModem starts a ModemWatcher reporting changes of the lines in mask, see WaitModemChange.
+// The lines are polled, so Close returns within ModemPollInterval.
+// On pseudo-terminals, which have no modem lines, no changes are reported.
+// Transitions between two changes are counted with TIOCGICOUNT where available,
+// so none are missed while a change is being delivered.
+func (p *Port) WatchModem(mask ModemLine) (*ModemWatcher, error) {
+	if mask&modemWaitLines == 0 {
+		return nil, wrapErr("WatchModem", syscall.EINVAL)
+	}
+	state, err := p.modemState()
+	if err != nil {
+		return nil, wrapErr("WatchModem", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	w := &ModemWatcher{
+		changes: make(chan ModemChange),
+		cancel:  cancel,
+		done:    make(chan struct{}),
+	}
+	go w.run(ctx, p, mask, state)
+	return w, nil
+}
+
+func (w *ModemWatcher) run(ctx context.Context, p *Port, mask ModemLine, state *modemState) {
+	defer close(w.done)
+	defer close(w.changes)
+	for {
+		before := state.lines
+		if err := p.waitModemChange(ctx, mask, state); err != nil {
+			if ctx.Err() == nil {
+				w.err = wrapErr("WatchModem", err)
+			}
+			return
+		}
+		select {
+		case w.changes <- ModemChange{Before: before, After: state.lines}:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Changes returns the channel on which changes are delivered.
+// The channel is closed when the ModemWatcher is closed or fails, see Err.
+func (w *ModemWatcher) Changes() <-chan ModemChange {
+	return w.changes
+}
+
+// Err returns the error that stopped the ModemWatcher, if any.
+// It is only valid after the Changes channel has been closed.
+func (w *ModemWatcher) Err() error {
+	return w.err
+}
+
+// Close stops the ModemWatcher.
+func (w *ModemWatcher) Close() error {
+	err := error(ErrClosed)
+	w.closeOnce.Do(func() {
+		w.cancel()
+		<-w.done
+		err = nil
+	})
+	return err
+}
@@ -0,0 +1,107 @@
+package serial
+
+import (
+	"context"
+	"errors"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestModemStateCountsMissedEdges(t *testing.T) {
+	state := &modemState{lines: TIOCM_CTS, counters: &Counters{CTS: 4, RNG: 2}}
+
+	// CTS dropped and came back between two polls.
+	if !state.changed(TIOCM_CTS, TIOCM_CTS, &Counters{CTS: 6, RNG: 2}) {
+		t.Fatal("CTS pulse not detected")
+	}
+	if state.changed(TIOCM_CTS, TIOCM_CTS, &Counters{CTS: 6, RNG: 2}) {
+		t.Fatal("change reported twice")
+	}
+	// RI edges are ignored unless asked for.
+	if state.changed(TIOCM_CTS|TIOCM_CD, TIOCM_CTS, &Counters{CTS: 6, RNG: 3}) {
+		t.Fatal("RI edge reported for mask without TIOCM_RNG")
+	}
+	if !state.changed(TIOCM_RNG, TIOCM_CTS, &Counters{CTS: 6, RNG: 4}) {
+		t.Fatal("RI edge not detected")
+	}
+	// Without counters only levels are compared.
+	if !state.changed(TIOCM_CD, TIOCM_CTS|TIOCM_CD, nil) {
+		t.Fatal("CD level change not detected")
+	}
+}
+
+func TestWaitModemChangeCanceled(t *testing.T) {
+	master, slave, err := OpenPTY(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer master.Close()
+	defer slave.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*ModemPollInterval)
+	defer cancel()
+	start := time.Now()
+	if _, err := slave.WaitModemChange(ctx, TIOCM_CTS|TIOCM_CD); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, want %v", err, context.DeadlineExceeded)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("returned after %v", d)
+	}
+	// Without a way to cancel, waiting on a pty would never end.
+	if _, err := slave.WaitModemChange(context.Background(), TIOCM_CTS); !errors.Is(err, syscall.ENOTTY) {
+		t.Fatalf("got %v, want ENOTTY", err)
+	}
+	if _, err := slave.WaitModemChange(ctx, TIOCM_DTR); !errors.Is(err, syscall.EINVAL) {
+		t.Fatalf("output line only: got %v, want EINVAL", err)
+	}
+}
+
+func TestModemWatcherClose(t *testing.T) {
+	master, slave, err := OpenPTY(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer master.Close()
+	defer slave.Close()
+
+	w, err := slave.WatchModem(TIOCM_CTS | TIOCM_DSR | TIOCM_CD | TIOCM_RNG)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case c, ok := <-w.Changes():
+		t.Fatalf("change %v, %v on a pty", c, ok)
+	case <-time.After(3 * ModemPollInterval):
+	}
+	start := time.Now()
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d > 2*ModemPollInterval {
+		t.Fatalf("Close took %v", d)
+	}
+	if _, ok := <-w.Changes(); ok {
+		t.Fatal("Changes not closed")
+	}
+	if err := w.Err(); err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	if err := w.Close(); err != ErrClosed {
+		t.Fatalf("second Close: got %v, want %v", err, ErrClosed)
+	}
+
+	// Files that are not terminals are still rejected.
+	r, wr, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer wr.Close()
+	p := &Port{options: NewOptions()}
+	p.f.Store(int(r.Fd()))
+	if _, err := p.WatchModem(TIOCM_CTS); !errors.Is(err, syscall.ENOTTY) {
+		t.Fatalf("WatchModem on a pipe: got %v, want ENOTTY", err)
+	}
+}
@@ -0,0 +1,135 @@
+package serial
+
+import (
+	"context"
+	"fmt"
+	"github.com/daedaluz/fdev/poll"
+	"io"
+	"strings"
+	"time"
+)
+
+func (c PacketControl) String() string {
+	if c == TIOCPKT_DATA {
+		return "[DATA]"
+	}
+	flags := make([]string, 0, len(packetControlStrings))
+	for i := 1; i <= int(TIOCPKT_IOCTL)<<1; i <<= 1 {
+		if int(c)&i > 0 {
+			if flag, ok := packetControlStrings[PacketControl(i)]; ok {
+				flags = append(flags, flag)
+			} else {
+				flags = append(flags, fmt.Sprintf("Unknown(%x)", i))
+			}
+		}
+	}
+	return fmt.Sprintf("[%s]", strings.Join(flags, "|"))
+}
+
+var packetControlStrings = map[PacketControl]string{
+	TIOCPKT_FLUSHREAD:  "FLUSHREAD",
+	TIOCPKT_FLUSHWRITE: "FLUSHWRITE",
+	TIOCPKT_STOP:       "STOP",
+	TIOCPKT_START:      "START",
+	TIOCPKT_NOSTOP:     "NOSTOP",
+	TIOCPKT_DOSTOP:     "DOSTOP",
+	TIOCPKT_IOCTL:      "IOCTL",
+}
+
+// Has returns true if all bits of flag are set in c.
+// Use c == TIOCPKT_DATA to test for data packets.
+func (c PacketControl) Has(flag PacketControl) bool {
+	return c&flag == flag
+}
+
+// packetSize is the largest packet read by a PacketReader, including the control byte.
+const packetSize = 4096 + 1
+
+// Packet is a packet read from a pseudo-terminal master in packet mode.
+type Packet struct {
+	// Control is TIOCPKT_DATA for data packets,
+	// otherwise the status changes of the slave.
+	Control PacketControl
+	// Data holds the data written on the slave side, for data packets only.
+	Data []byte
+}
+
+// PacketReader reads packets from a pseudo-terminal master in packet mode,
+// splitting off the leading PacketControl byte.
+type PacketReader struct {
+	port *Port
+	buf  []byte
+}
+
+// NewPacketReader enables packet mode on the pseudo-terminal master
+// and returns a PacketReader for it.
+func NewPacketReader(master *Port) (*PacketReader, error) {
+	if err := master.SetPacketMode(true); err != nil {
+		return nil, err
+	}
+	return &PacketReader{port: master, buf: make([]byte, packetSize)}, nil
+}
+
+// ReadPacket reads the next packet.
+// The read timeout of the Port, if any, is honoured.
+// Once the slave is closed and all data is read, an EIO error is returned.
+func (r *PacketReader) ReadPacket() (*Packet, error) {
+	return r.readPacket(context.Background(), "ReadPacket", r.port.options.ReadTimeout)
+}
+
+// ReadPacketTimeout reads the next packet with timeout.
+func (r *PacketReader) ReadPacketTimeout(timeout time.Duration) (*Packet, error) {
+	return r.readPacket(context.Background(), "ReadPacketTimeout", timeout)
+}
+
+// ReadPacketContext reads the next packet, aborting when ctx is done.
+// The read timeout of the Port, if any, is honoured as well.
+func (r *PacketReader) ReadPacketContext(ctx context.Context) (*Packet, error) {
+	return r.readPacket(ctx, "ReadPacketContext", r.port.options.ReadTimeout)
+}
+
+func (r *PacketReader) readPacket(ctx context.Context, op string, timeout time.Duration) (*Packet, error) {
+	n, err := r.port.read(ctx, op, r.buf, timeout)
+	if err != nil {
+		return nil, err
+	}
+	if n == 0 {
+		return nil, io.EOF
+	}
+	pkt := &Packet{Control: PacketControl(r.buf[0])}
+	if pkt.Control == TIOCPKT_DATA {
+		pkt.Data = append([]byte(nil), r.buf[1:n]...)
+	}
+	return pkt, nil
+}
+
+// WaitControl blocks until a status change is pending on the master (POLLPRI),
+// the timeout expires or ctx is done. A negative timeout waits forever.
+// Pending data does not end the wait, a hangup does and is reported by the following read.
+func (r *PacketReader) WaitControl(ctx context.Context, timeout time.Duration) error {
+	w, err := r.port.acquireWaiter()
+	if err != nil {
+		return wrapErr("WaitControl", err)
+	}
+	defer r.port.releaseWaiter(w)
+	var end time.Time
+	if timeout > -1 {
+		end = time.Now().Add(timeout)
+	}
+	for {
+		// Deadline changes also wake the wait, they do not apply to it.
+		err = r.port.waitEvents(ctx, poll.POLLPRI, timeout, w)
+		if err != errInterrupted {
+			break
+		}
+		if !end.IsZero() {
+			if timeout = time.Until(end); timeout < 0 {
+				timeout = 0
+			}
+		}
+	}
+	if err == poll.ErrTimeout {
+		err = ErrTimeout
+	}
+	return wrapErr("WaitControl", err)
+}
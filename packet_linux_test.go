@@ -0,0 +1,106 @@
+package serial
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPacketControlString(t *testing.T) {
+	for _, tt := range []struct {
+		c    PacketControl
+		want string
+	}{
+		{TIOCPKT_DATA, "[DATA]"},
+		{TIOCPKT_FLUSHREAD | TIOCPKT_FLUSHWRITE, "[FLUSHREAD|FLUSHWRITE]"},
+		{TIOCPKT_STOP | TIOCPKT_DOSTOP, "[STOP|DOSTOP]"},
+		{TIOCPKT_IOCTL | 0x80, "[IOCTL|Unknown(80)]"},
+	} {
+		if got := tt.c.String(); got != tt.want {
+			t.Fatalf("%#x: got %q, want %q", uint8(tt.c), got, tt.want)
+		}
+	}
+	c := TIOCPKT_FLUSHREAD | TIOCPKT_FLUSHWRITE
+	if !c.Has(TIOCPKT_FLUSHREAD) || !c.Has(c) || c.Has(TIOCPKT_FLUSHREAD|TIOCPKT_STOP) {
+		t.Fatalf("Has: %v", c)
+	}
+}
+
+func openPacketPTY(t *testing.T) (*PacketReader, *Port) {
+	t.Helper()
+	master, slave, err := OpenPTY(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		master.Close()
+		slave.Close()
+	})
+	r, err := NewPacketReader(master)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if on, err := master.GetPacketMode(); err != nil || !on {
+		t.Fatalf("GetPacketMode: got %v, %v", on, err)
+	}
+	return r, slave
+}
+
+func TestPacketReader(t *testing.T) {
+	r, slave := openPacketPTY(t)
+	if _, err := slave.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	pkt, err := r.ReadPacketTimeout(time.Second)
+	if err != nil || pkt.Control != TIOCPKT_DATA || string(pkt.Data) != "hello" {
+		t.Fatalf("got %+v, %v", pkt, err)
+	}
+
+	if err := slave.Flush(TCIOFLUSH); err != nil {
+		t.Fatal(err)
+	}
+	pkt, err = r.ReadPacketTimeout(time.Second)
+	if err != nil || pkt.Control != TIOCPKT_FLUSHREAD|TIOCPKT_FLUSHWRITE || pkt.Data != nil {
+		t.Fatalf("got %+v, %v", pkt, err)
+	}
+
+	if _, err := r.ReadPacketTimeout(50 * time.Millisecond); !errors.Is(err, ErrTimeout) {
+		t.Fatalf("got %v, want ErrTimeout", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	if _, err := r.ReadPacketContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("got %v, want context.Canceled", err)
+	}
+}
+
+func TestWaitControl(t *testing.T) {
+	r, slave := openPacketPTY(t)
+	if err := r.WaitControl(context.Background(), 50*time.Millisecond); !errors.Is(err, ErrTimeout) {
+		t.Fatalf("got %v, want ErrTimeout", err)
+	}
+	// Pending data does not end the wait.
+	if _, err := slave.Write([]byte("data")); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.WaitControl(context.Background(), 50*time.Millisecond); !errors.Is(err, ErrTimeout) {
+		t.Fatalf("got %v, want ErrTimeout", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	if err := r.WaitControl(ctx, -1); !errors.Is(err, context.Canceled) {
+		t.Fatalf("got %v, want context.Canceled", err)
+	}
+
+	// Flushing the output of the slave discards the pending data.
+	time.AfterFunc(50*time.Millisecond, func() { slave.Flush(TCOFLUSH) })
+	if err := r.WaitControl(context.Background(), time.Second); err != nil {
+		t.Fatal(err)
+	}
+	pkt, err := r.ReadPacketTimeout(time.Second)
+	if err != nil || pkt.Control != TIOCPKT_FLUSHWRITE {
+		t.Fatalf("got %+v, %v", pkt, err)
+	}
+}
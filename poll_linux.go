@@ -0,0 +1,201 @@
+package serial
+
+import (
+	"context"
+	"errors"
+	"github.com/daedaluz/fdev/poll"
+	"syscall"
+	"time"
+)
+
+// waiter is an eventfd polled along with the port by a pending read or write,
+// signalled to wake it up when a deadline changes, its context is done or the port is closed.
+// Waiters are reused by later calls once they return.
+type waiter struct {
+	fd int
+	// signalled is set when fd has to be drained before polling it again.
+	signalled bool
+}
+
+// acquireWaiter returns an idle waiter of the port, creating one if all are in use.
+// Until it is released, every deadline change signals it.
+func (p *Port) acquireWaiter() (*waiter, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return nil, ErrClosed
+	}
+	var w *waiter
+	if n := len(p.idle); n > 0 {
+		w = p.idle[n-1]
+		p.idle = p.idle[:n-1]
+	} else {
+		fd, err := newEventFd()
+		if err != nil {
+			return nil, err
+		}
+		w = &waiter{fd: fd}
+	}
+	if p.busy == nil {
+		p.busy = make(map[*waiter]struct{})
+	}
+	p.busy[w] = struct{}{}
+	return w, nil
+}
+
+// releaseWaiter makes w available to other calls, or closes it if the port was closed.
+func (p *Port) releaseWaiter(w *waiter) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.busy, w)
+	if p.closed {
+		syscall.Close(w.fd)
+		return
+	}
+	p.reset(w)
+	p.idle = append(p.idle, w)
+}
+
+// wake signals w.
+func (p *Port) wake(w *waiter) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.signal(w)
+}
+
+// wakeAll signals every busy waiter, the caller holds p.mu.
+func (p *Port) wakeAll() {
+	for w := range p.busy {
+		p.signal(w)
+	}
+}
+
+// signal makes w readable, the caller holds p.mu.
+func (p *Port) signal(w *waiter) {
+	if !w.signalled {
+		signalEventFd(w.fd)
+		w.signalled = true
+	}
+}
+
+// reset makes w not readable, the caller holds p.mu.
+func (p *Port) reset(w *waiter) {
+	if w.signalled {
+		drainEventFd(w.fd)
+		w.signalled = false
+	}
+}
+
+// closeWaiters wakes the pending calls and closes the idle waiters,
+// busy ones are closed as they are released.
+func (p *Port) closeWaiters() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	p.wakeAll()
+	for _, w := range p.idle {
+		syscall.Close(w.fd)
+	}
+	p.idle = nil
+}
+
+// newEventFd returns a non-blocking eventfd.
+func newEventFd() (int, error) {
+	fd, _, errno := syscall.RawSyscall(syscall.SYS_EVENTFD2, 0, syscall.O_CLOEXEC|syscall.O_NONBLOCK, 0)
+	if errno != 0 {
+		return -1, errno
+	}
+	return int(fd), nil
+}
+
+// signalEventFd makes the eventfd readable.
+func signalEventFd(fd int) {
+	one := [8]byte{1}
+	syscall.Write(fd, one[:])
+}
+
+// drainEventFd resets the eventfd to not readable.
+func drainEventFd(fd int) {
+	var buf [8]byte
+	syscall.Read(fd, buf[:])
+}
+
+// errInterrupted is returned by waitEvents when its waiter is signalled for a deadline change.
+var errInterrupted = errors.New("interrupted")
+
+// waitEvents blocks until one of events is signalled on the port,
+// the timeout expires, ctx is done or w is signalled.
+// A negative timeout waits forever.
+func (p *Port) waitEvents(ctx context.Context, events poll.Event, timeout time.Duration, w *waiter) error {
+	fd := p.f.Load().(int)
+	if fd == -1 {
+		return ErrClosed
+	}
+	if done := ctx.Done(); done != nil {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		quit := make(chan struct{})
+		finished := make(chan struct{})
+		go func() {
+			defer close(finished)
+			select {
+			case <-done:
+				p.wake(w)
+			case <-quit:
+			}
+		}()
+		defer func() {
+			close(quit)
+			<-finished
+		}()
+	}
+	fds := []poll.PollFd{
+		{Fd: int32(fd), Events: events},
+		{Fd: int32(w.fd), Events: poll.POLLIN},
+	}
+	var deadline time.Time
+	if timeout > -1 {
+		deadline = time.Now().Add(timeout)
+	}
+	for {
+		wait := time.Duration(-1)
+		if !deadline.IsZero() {
+			// Round up so that we never spin on sub-millisecond remainders.
+			if wait = time.Until(deadline); wait > 0 {
+				wait += time.Millisecond - 1
+			} else {
+				wait = 0
+			}
+		}
+		for i := range fds {
+			fds[i].REvents = 0
+		}
+		if _, err := poll.Poll(fds, wait); err != nil {
+			return err
+		}
+		if fds[1].REvents != 0 {
+			p.mu.Lock()
+			p.reset(w)
+			p.mu.Unlock()
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if p.f.Load().(int) == -1 {
+				return ErrClosed
+			}
+			return errInterrupted
+		}
+		if e := fds[0].REvents; e != 0 {
+			if e&poll.POLLNVAL > 0 {
+				return poll.ErrInvalidFd
+			}
+			// Errors and hangups are reported by the following read or write.
+			return nil
+		}
+		// Nothing signalled; either the timeout expired or poll was interrupted.
+		if !deadline.IsZero() && !time.Now().Before(deadline) {
+			return poll.ErrTimeout
+		}
+	}
+}
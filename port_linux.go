@@ -1,10 +1,12 @@
 package serial
 
 import (
+	"context"
 	"fmt"
 	"github.com/daedaluz/fdev/poll"
 	ioctl "github.com/daedaluz/goioctl"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"syscall"
 	"time"
@@ -187,6 +189,45 @@ type RS485 struct {
 	padding            [5]uint32
 }
 
+// Counters holds the interrupt and error counters of a serial port (serial_icounter_struct).
+// Counters are free running and wrap around, see Delta.
+type Counters struct {
+	CTS        int32 /* CTS transitions */
+	DSR        int32 /* DSR transitions */
+	RNG        int32 /* RI trailing edges */
+	DCD        int32 /* DCD transitions */
+	RX         int32 /* characters received */
+	TX         int32 /* characters transmitted */
+	Frame      int32 /* framing errors */
+	Overrun    int32 /* hardware overruns */
+	Parity     int32 /* parity errors */
+	Brk        int32 /* breaks received */
+	BufOverrun int32 /* tty buffer overruns */
+	reserved   [9]int32
+}
+
+// Delta returns the change of every counter since prev.
+func (c *Counters) Delta(prev *Counters) *Counters {
+	return &Counters{
+		CTS:        c.CTS - prev.CTS,
+		DSR:        c.DSR - prev.DSR,
+		RNG:        c.RNG - prev.RNG,
+		DCD:        c.DCD - prev.DCD,
+		RX:         c.RX - prev.RX,
+		TX:         c.TX - prev.TX,
+		Frame:      c.Frame - prev.Frame,
+		Overrun:    c.Overrun - prev.Overrun,
+		Parity:     c.Parity - prev.Parity,
+		Brk:        c.Brk - prev.Brk,
+		BufOverrun: c.BufOverrun - prev.BufOverrun,
+	}
+}
+
+// Errors returns the sum of the framing, overrun, parity and buffer overrun counters.
+func (c *Counters) Errors() int32 {
+	return c.Frame + c.Overrun + c.Parity + c.BufOverrun
+}
+
 // Control characters
 const (
 	// VINTR
@@ -719,18 +760,51 @@ const (
 	N_HDLC
 	N_SYNC_PPP
 	N_HCI
+	N_GIGASET_M101
+	N_SLCAN
+	N_PPS
+	N_V253
+	N_CAIF
+	N_GSM0710
+	N_TI_WL
+	N_TRACESINK
+	N_TRACEROUTER
+	N_NCI
+	N_SPEAKUP
+	N_NULL
+	N_MCTP
+	N_DEVELOPMENT
+	N_CAN327
 )
 
+// PacketControl is the leading byte of a packet read from a pseudo-terminal master in packet mode.
+// Several status bits may be set in a single packet.
 type PacketControl uint8
 
 const (
-	TIOCPKT_DATA = PacketControl(1 << iota)
-	TIOCPKT_FLUSHREAD
+	// TIOCPKT_DATA
+	// The packet contains data written on the slave side.
+	TIOCPKT_DATA = PacketControl(0)
+	// TIOCPKT_FLUSHREAD
+	// The read queue of the terminal was flushed.
+	TIOCPKT_FLUSHREAD = PacketControl(1 << (iota - 1))
+	// TIOCPKT_FLUSHWRITE
+	// The write queue of the terminal was flushed.
 	TIOCPKT_FLUSHWRITE
+	// TIOCPKT_STOP
+	// Output to the terminal was stopped (^S).
 	TIOCPKT_STOP
+	// TIOCPKT_START
+	// Output to the terminal was restarted (^Q).
 	TIOCPKT_START
+	// TIOCPKT_NOSTOP
+	// The stop and start characters are no longer ^S/^Q.
 	TIOCPKT_NOSTOP
+	// TIOCPKT_DOSTOP
+	// The stop and start characters are ^S/^Q.
 	TIOCPKT_DOSTOP
+	// TIOCPKT_IOCTL
+	// The terminal settings changed, with extended packet mode only.
 	TIOCPKT_IOCTL
 )
 
@@ -738,6 +812,12 @@ const (
 type Options struct {
 	ReadTimeout time.Duration
 	OpenMode    int
+	// LockDir enables UUCP style lock files (LCK..ttyUSB0) in the given directory,
+	// usually DefaultLockDir. Locking is disabled when empty.
+	LockDir string
+	// RestoreOnClose saves the port settings when the Port is created
+	// and restores them when it is closed, see SaveState.
+	RestoreOnClose bool
 }
 
 // NewOptions returns a new Options with default values.
@@ -755,29 +835,78 @@ func (o *Options) SetReadTimeout(timeout time.Duration) *Options {
 	return o
 }
 
+// SetLockDir enables UUCP style lock files in dir, see Options.LockDir.
+func (o *Options) SetLockDir(dir string) *Options {
+	o.LockDir = dir
+	return o
+}
+
+// SetRestoreOnClose enables or disables restoring the port settings on close, see Options.RestoreOnClose.
+func (o *Options) SetRestoreOnClose(restore bool) *Options {
+	o.RestoreOnClose = restore
+	return o
+}
+
 // Port represents a serial port.
 type Port struct {
-	options *Options
-	f       atomic.Value
+	options  *Options
+	f        atomic.Value
+	ldisc    int32
+	lockFile string
+	saved    *PortState
+
+	mu sync.Mutex
+	// clearNonblock is set when O_NONBLOCK was set by the Port and is cleared again by Close,
+	// as the file status flags are shared with every descriptor of the open file.
+	clearNonblock bool
+	// idle holds the waiters not used by a pending call, busy those that are.
+	idle          []*waiter
+	busy          map[*waiter]struct{}
+	closed        bool
+	readDeadline  time.Time
+	writeDeadline time.Time
 }
 
 // Open a serial port with the given name and options.
+//
+// The file descriptor is switched to non-blocking mode and reads and writes wait for it with poll,
+// which lets deadlines, timeouts and contexts interrupt them.
+// Reads therefore return as soon as any data is available, VTIME is not used.
 func Open(name string, opts *Options) (*Port, error) {
 	if opts == nil {
 		opts = NewOptions()
 	}
+	var lockFile string
+	if opts.LockDir != "" {
+		var err error
+		if lockFile, err = createLockFile(opts.LockDir, name); err != nil {
+			return nil, wrapErr("Open", err)
+		}
+	}
 	fd, err := syscall.Open(name, opts.OpenMode, 0)
 	if err != nil {
+		removeLockFile(lockFile)
 		return nil, wrapErr("Open", err)
 	}
 	res := &Port{
-		options: opts,
+		options:  opts,
+		lockFile: lockFile,
 	}
 	res.f.Store(fd)
+	if err := res.saveOnOpen(); err != nil {
+		res.Close()
+		return nil, wrapErr("Open", err)
+	}
+	if err := res.initWait(); err != nil {
+		res.Close()
+		return nil, wrapErr("Open", err)
+	}
 	return res, nil
 }
 
 // NewPort returns a Port with the given file descriptor and options.
+// Like Open, it switches fd to non-blocking mode. As the mode is shared with
+// every descriptor of the open file, Close switches it back.
 func NewPort(fd int, opts *Options) (*Port, error) {
 	if opts == nil {
 		opts = NewOptions()
@@ -786,35 +915,129 @@ func NewPort(fd int, opts *Options) (*Port, error) {
 		options: opts,
 	}
 	res.f.Store(fd)
+	if err := res.saveOnOpen(); err != nil {
+		return nil, wrapErr("NewPort", err)
+	}
+	if err := res.initWait(); err != nil {
+		return nil, wrapErr("NewPort", err)
+	}
 	return res, nil
 }
 
-// Write data to the serial port.
-func (p *Port) Write(data []byte) (n int, err error) {
-	x, err := syscall.Write(p.f.Load().(int), data)
-	return x, wrapErr("Write", err)
+func (p *Port) saveOnOpen() error {
+	if !p.options.RestoreOnClose {
+		return nil
+	}
+	state, err := p.SaveState()
+	p.saved = state
+	return err
 }
 
-func (p *Port) readTimeout(data []byte, timeout time.Duration) (int, error) {
-	if err := poll.WaitInput(p.f.Load().(int), timeout); err != nil {
-		return 0, wrapErr("", err)
-	}
-	n, err := syscall.Read(p.f.Load().(int), data)
-	return n, wrapErr("ReadTimeout", err)
+// Write data to the serial port.
+func (p *Port) Write(data []byte) (n int, err error) {
+	return p.write(context.Background(), "Write", data)
 }
 
 // Read data from the serial port.
 func (p *Port) Read(data []byte) (n int, err error) {
-	if p.options.ReadTimeout > -1 {
-		return p.readTimeout(data, p.options.ReadTimeout)
-	}
-	n, err = syscall.Read(p.f.Load().(int), data)
-	return n, wrapErr("Read", err)
+	return p.read(context.Background(), "Read", data, p.options.ReadTimeout)
 }
 
 // ReadTimeout reads data with timeout.
 func (p *Port) ReadTimeout(data []byte, timeout time.Duration) (n int, err error) {
-	return p.readTimeout(data, timeout)
+	return p.read(context.Background(), "ReadTimeout", data, timeout)
+}
+
+// ReadContext reads data from the serial port, aborting when ctx is done.
+// The read timeout of the Port, if any, is honoured as well.
+func (p *Port) ReadContext(ctx context.Context, data []byte) (n int, err error) {
+	return p.read(ctx, "ReadContext", data, p.options.ReadTimeout)
+}
+
+// WriteContext writes data to the serial port, aborting when ctx is done.
+// Data is written as the output buffer drains, so n may be less than len(data)
+// when the write is cancelled.
+func (p *Port) WriteContext(ctx context.Context, data []byte) (n int, err error) {
+	return p.write(ctx, "WriteContext", data)
+}
+
+func (p *Port) read(ctx context.Context, op string, data []byte, timeout time.Duration) (int, error) {
+	w, err := p.acquireWaiter()
+	if err != nil {
+		return 0, wrapErr(op, err)
+	}
+	defer p.releaseWaiter(w)
+	var end time.Time
+	if timeout > -1 {
+		end = time.Now().Add(timeout)
+	}
+	for {
+		if err := ctx.Err(); err != nil {
+			return 0, wrapErr(op, err)
+		}
+		t := p.getDeadline(&p.readDeadline)
+		if !t.IsZero() && !time.Now().Before(t) {
+			return 0, wrapErr(op, ErrTimeout)
+		}
+		n, err := syscall.Read(p.f.Load().(int), data)
+		if err != syscall.EAGAIN {
+			return n, wrapErr(op, err)
+		}
+		if !end.IsZero() && (t.IsZero() || end.Before(t)) {
+			t = end
+		}
+		wait := time.Duration(-1)
+		if !t.IsZero() {
+			if wait = time.Until(t); wait <= 0 {
+				return 0, wrapErr(op, ErrTimeout)
+			}
+		}
+		if err := p.waitEvents(ctx, poll.POLLIN, wait, w); err != nil && err != errInterrupted {
+			if err == poll.ErrTimeout {
+				err = ErrTimeout
+			}
+			return 0, wrapErr(op, err)
+		}
+	}
+}
+
+func (p *Port) write(ctx context.Context, op string, data []byte) (n int, err error) {
+	w, err := p.acquireWaiter()
+	if err != nil {
+		return 0, wrapErr(op, err)
+	}
+	defer p.releaseWaiter(w)
+	for {
+		if err := ctx.Err(); err != nil {
+			return n, wrapErr(op, err)
+		}
+		t := p.getDeadline(&p.writeDeadline)
+		if !t.IsZero() && !time.Now().Before(t) {
+			return n, wrapErr(op, ErrTimeout)
+		}
+		x, err := syscall.Write(p.f.Load().(int), data[n:])
+		if x > 0 {
+			n += x
+		}
+		if err != nil && err != syscall.EAGAIN {
+			return n, wrapErr(op, err)
+		}
+		if n == len(data) {
+			return n, nil
+		}
+		wait := time.Duration(-1)
+		if !t.IsZero() {
+			if wait = time.Until(t); wait <= 0 {
+				return n, wrapErr(op, ErrTimeout)
+			}
+		}
+		if err := p.waitEvents(ctx, poll.POLLOUT, wait, w); err != nil && err != errInterrupted {
+			if err == poll.ErrTimeout {
+				err = ErrTimeout
+			}
+			return n, wrapErr(op, err)
+		}
+	}
 }
 
 // SetReadTimeout sets the read timeout for the serial port.
@@ -822,14 +1045,93 @@ func (p *Port) SetReadTimeout(timeout time.Duration) {
 	p.options.ReadTimeout = timeout
 }
 
+// SetDeadline sets both the read and write deadlines, see SetReadDeadline and SetWriteDeadline.
+func (p *Port) SetDeadline(t time.Time) error {
+	return wrapErr("SetDeadline", p.setDeadline(&p.readDeadline, &p.writeDeadline, t))
+}
+
+// SetReadDeadline sets the deadline for future and pending reads, like net.Conn.
+// A zero value for t means reads will not time out.
+// An expired deadline makes reads fail with an error matching os.ErrDeadlineExceeded.
+func (p *Port) SetReadDeadline(t time.Time) error {
+	return wrapErr("SetReadDeadline", p.setDeadline(&p.readDeadline, nil, t))
+}
+
+// SetWriteDeadline sets the deadline for future and pending writes, like net.Conn.
+// A zero value for t means writes will not time out.
+// An expired deadline makes writes fail with an error matching os.ErrDeadlineExceeded,
+// some data may have been written regardless.
+func (p *Port) SetWriteDeadline(t time.Time) error {
+	return wrapErr("SetWriteDeadline", p.setDeadline(&p.writeDeadline, nil, t))
+}
+
+// initWait switches the file descriptor to non-blocking mode and creates the first waiter.
+func (p *Port) initWait() error {
+	fd := p.f.Load().(int)
+	flags, _, errno := syscall.Syscall(syscall.SYS_FCNTL, uintptr(fd), syscall.F_GETFL, 0)
+	if errno != 0 {
+		return errno
+	}
+	wake, err := newEventFd()
+	if err != nil {
+		return err
+	}
+	if flags&syscall.O_NONBLOCK == 0 {
+		if err := syscall.SetNonblock(fd, true); err != nil {
+			syscall.Close(wake)
+			return err
+		}
+		p.clearNonblock = true
+	}
+	p.idle = []*waiter{{fd: wake}}
+	return nil
+}
+
+// setDeadline sets the deadlines d and e, if not nil, to t and wakes the pending calls to pick them up.
+func (p *Port) setDeadline(d, e *time.Time, t time.Time) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return ErrClosed
+	}
+	*d = t
+	if e != nil {
+		*e = t
+	}
+	p.wakeAll()
+	return nil
+}
+
+func (p *Port) getDeadline(d *time.Time) time.Time {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return *d
+}
+
 // Fd returns the file descriptor referencing the open serial port.
+// It is in non-blocking mode until the Port is closed.
 func (p *Port) Fd() int {
 	return p.f.Load().(int)
 }
 
 // Close the serial port.
+// If a line discipline other than N_TTY was attached with SetLineDiscipline, N_TTY is restored first.
+// With Options.RestoreOnClose the settings saved at open are restored.
+// O_NONBLOCK is cleared if it was set by the Port.
+// The lock file, if any, is removed.
 func (p *Port) Close() error {
+	if atomic.LoadInt32(&p.ldisc) != 0 {
+		p.SetLineDiscipline(N_TTY)
+	}
+	if p.saved != nil && p.f.Load().(int) != -1 {
+		p.RestoreState(p.saved)
+	}
 	if x := p.f.Swap(-1); x != -1 {
+		defer removeLockFile(p.lockFile)
+		p.closeWaiters()
+		if p.clearNonblock {
+			syscall.SetNonblock(x.(int), false)
+		}
 		return wrapErr("Close", syscall.Close(x.(int)))
 	}
 	return ErrClosed
@@ -956,6 +1258,42 @@ func (p *Port) SetRS485(cfg *RS485) error {
 	return wrapErr("SetRS485", ioctl.Ioctl(uintptr(p.f.Load().(int)), tiocsrs485, uintptr(unsafe.Pointer(cfg))))
 }
 
+// Counters
+// Returns the interrupt and error counters of the serial port.
+func (p *Port) Counters() (*Counters, error) {
+	counters := &Counters{}
+	err := ioctl.Ioctl(uintptr(p.f.Load().(int)), tiocgicount, uintptr(unsafe.Pointer(counters)))
+	if err != nil {
+		return nil, wrapErr("Counters", err)
+	}
+	return counters, nil
+}
+
+// GetLineDiscipline
+// Returns the line discipline attached to the terminal.
+func (p *Port) GetLineDiscipline() (Discipline, error) {
+	var ldisc int32
+	err := ioctl.Ioctl(uintptr(p.f.Load().(int)), tiocgetd, uintptr(unsafe.Pointer(&ldisc)))
+	return Discipline(ldisc), wrapErr("GetLineDiscipline", err)
+}
+
+// SetLineDiscipline
+// Attaches the given line discipline, such as N_SLIP, N_PPP, N_HCI or N_GSM0710, to the terminal.
+// A Port with a discipline other than N_TTY attached is switched back to N_TTY when closed.
+func (p *Port) SetLineDiscipline(ldisc Discipline) error {
+	x := int32(ldisc)
+	err := ioctl.Ioctl(uintptr(p.f.Load().(int)), tiocsetd, uintptr(unsafe.Pointer(&x)))
+	if err != nil {
+		return wrapErr("SetLineDiscipline", err)
+	}
+	if ldisc == N_TTY {
+		atomic.StoreInt32(&p.ldisc, 0)
+	} else {
+		atomic.StoreInt32(&p.ldisc, 1)
+	}
+	return nil
+}
+
 // MakeRaw
 // Sets the Port to a "raw" mode
 func (p *Port) MakeRaw() error {
@@ -0,0 +1,193 @@
+package serial
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestWriteContextCancel(t *testing.T) {
+	master, slave, err := OpenPTY(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer master.Close()
+	defer slave.Close()
+
+	// Nobody reads the master, so the write stalls once the pty buffer is full.
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	n, err := slave.WriteContext(ctx, make([]byte, 1<<20))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("WriteContext: got %v, want %v", err, context.DeadlineExceeded)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("WriteContext returned after %v", d)
+	}
+	if n <= 0 || n >= 1<<20 {
+		t.Fatalf("WriteContext wrote %d bytes", n)
+	}
+
+	// Plain writes still wait for the buffer to drain.
+	go func() {
+		buf := make([]byte, 4096)
+		for {
+			if _, err := master.Read(buf); err != nil {
+				return
+			}
+		}
+	}()
+	if n, err := slave.Write(make([]byte, 1<<16)); err != nil || n != 1<<16 {
+		t.Fatalf("Write: %d, %v", n, err)
+	}
+}
+
+func TestSetReadDeadlineWakesReads(t *testing.T) {
+	master, slave, err := OpenPTY(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer master.Close()
+	defer slave.Close()
+
+	// Both reads start before any deadline is set.
+	done := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			_, err := slave.Read(make([]byte, 1))
+			done <- err
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	if err := slave.SetReadDeadline(time.Now().Add(50 * time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		select {
+		case err := <-done:
+			if !errors.Is(err, os.ErrDeadlineExceeded) {
+				t.Fatalf("Read: got %v, want %v", err, os.ErrDeadlineExceeded)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Read did not pick up the new deadline")
+		}
+	}
+
+	// Clearing the deadline lets reads wait for data again.
+	if err := slave.SetReadDeadline(time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		_, err := slave.Read(make([]byte, 1))
+		done <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	if _, err := master.Write([]byte("x\n")); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Read: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Read did not return the data")
+	}
+}
+
+func TestCloseWakesRead(t *testing.T) {
+	master, slave, err := OpenPTY(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer master.Close()
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := slave.Read(make([]byte, 1))
+		done <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	slave.Close()
+	select {
+	case err := <-done:
+		if !errors.Is(err, ErrClosed) {
+			t.Fatalf("Read: got %v, want %v", err, ErrClosed)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Read not woken by Close")
+	}
+}
+
+func TestCloseRestoresBlocking(t *testing.T) {
+	master, slave, err := OpenPTY(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer master.Close()
+	defer slave.Close()
+	n, err := master.PTSNumber()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tty, err := syscall.Open(fmt.Sprintf("/dev/pts/%d", n), syscall.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer syscall.Close(tty)
+	getFlags := func() uintptr {
+		flags, _, errno := syscall.Syscall(syscall.SYS_FCNTL, uintptr(tty), syscall.F_GETFL, 0)
+		if errno != 0 {
+			t.Fatal(errno)
+		}
+		return flags
+	}
+	if getFlags()&syscall.O_NONBLOCK != 0 {
+		t.Fatal("O_NONBLOCK set on open")
+	}
+
+	// A Port on a duplicate shares the file status flags, like one on an inherited descriptor.
+	fd, err := syscall.Dup(tty)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := NewPort(fd, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if getFlags()&syscall.O_NONBLOCK == 0 {
+		t.Fatal("O_NONBLOCK not set by NewPort")
+	}
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if getFlags()&syscall.O_NONBLOCK != 0 {
+		t.Fatal("O_NONBLOCK left set after Close")
+	}
+}
+
+func TestReadContextReusesWaiter(t *testing.T) {
+	master, slave, err := OpenPTY(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer master.Close()
+	defer slave.Close()
+
+	for i := 0; i < 100; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+		_, err := slave.ReadContext(ctx, make([]byte, 1))
+		cancel()
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("ReadContext: got %v, want %v", err, context.DeadlineExceeded)
+		}
+	}
+	if n := len(slave.idle); n != 1 {
+		t.Fatalf("%d idle waiters, want 1", n)
+	}
+}
@@ -1,5 +1,13 @@
 package serial
 
+import (
+	"os"
+	"os/exec"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
 // OpenPTY finds an available pseudoterminal and returns a master and slave port.
 // If termp is non-nil, the slave port will be configured with the given termios.
 // If winp is non-nil, the slave port will be configured with the given window size.
@@ -12,7 +20,7 @@ func OpenPTY(termp *Termios, winp *Winsize) (*Port, *Port, error) {
 		master.Close()
 		return nil, nil, err
 	}
-	slave, err := master.GetPTPeer(0)
+	slave, err := master.GetPTPeer(syscall.O_RDWR | syscall.O_NOCTTY)
 	if err != nil {
 		master.Close()
 		return nil, nil, err
@@ -32,3 +40,98 @@ func OpenPTY(termp *Termios, winp *Winsize) (*Port, *Port, error) {
 
 	return master, slave, nil
 }
+
+// StartCommand starts cmd on a new pseudoterminal and returns the master port.
+// The slave becomes the controlling terminal of cmd in a new session, and its
+// standard input, output and error unless already set on cmd.
+// termp and winp configure the slave as in OpenPTY.
+// The slave is closed in the parent once cmd has started, so reads from the master
+// fail with EIO after cmd and its children exit.
+func StartCommand(cmd *exec.Cmd, termp *Termios, winp *Winsize) (*Port, error) {
+	master, slave, err := OpenPTY(termp, winp)
+	if err != nil {
+		return nil, err
+	}
+	defer slave.Close()
+	fd, err := syscall.Dup(slave.Fd())
+	if err != nil {
+		master.Close()
+		return nil, wrapErr("StartCommand", err)
+	}
+	// cmd expects blocking standard files, the mode of slave no longer matters as it is closed below.
+	if err := syscall.SetNonblock(fd, false); err != nil {
+		syscall.Close(fd)
+		master.Close()
+		return nil, wrapErr("StartCommand", err)
+	}
+	tty := os.NewFile(uintptr(fd), "/dev/pts")
+	defer tty.Close()
+
+	if cmd.Stdin == nil {
+		cmd.Stdin = tty
+	}
+	if cmd.Stdout == nil {
+		cmd.Stdout = tty
+	}
+	if cmd.Stderr == nil {
+		cmd.Stderr = tty
+	}
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setsid = true
+	cmd.SysProcAttr.Setctty = true
+	// Ctty is a file descriptor in the child.
+	if cmd.Stdin == tty {
+		cmd.SysProcAttr.Ctty = 0
+	} else {
+		cmd.ExtraFiles = append(cmd.ExtraFiles, tty)
+		cmd.SysProcAttr.Ctty = 2 + len(cmd.ExtraFiles)
+	}
+	if err := cmd.Start(); err != nil {
+		master.Close()
+		return nil, err
+	}
+	return master, nil
+}
+
+// ForwardWinSize copies the window size of the terminal from to the pseudoterminal
+// master to, once right away and again every time the process receives SIGWINCH.
+// Setting the size on the master signals SIGWINCH to the foreground process group of the slave.
+// The returned stop function stops forwarding and waits for a pending copy to finish.
+func ForwardWinSize(from, to *Port) (stop func(), err error) {
+	copySize := func() error {
+		ws, err := from.GetWinSize()
+		if err != nil {
+			return err
+		}
+		return to.SetWinSize(ws)
+	}
+	if err := copySize(); err != nil {
+		return nil, err
+	}
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGWINCH)
+	quit := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		for {
+			select {
+			case <-sig:
+				// Resizes are best effort, a failure is retried on the next signal.
+				copySize()
+			case <-quit:
+				return
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			signal.Stop(sig)
+			close(quit)
+			<-finished
+		})
+	}, nil
+}
@@ -0,0 +1,62 @@
+package serial
+
+import (
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestForwardWinSize(t *testing.T) {
+	// The host terminal the user sits at, and the pty of the proxied child.
+	hostMaster, hostSlave, err := OpenPTY(nil, &Winsize{Row: 24, Col: 80})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer hostMaster.Close()
+	defer hostSlave.Close()
+	childMaster, childSlave, err := OpenPTY(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer childMaster.Close()
+	defer childSlave.Close()
+
+	stop, err := ForwardWinSize(hostSlave, childMaster)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitSize := func(want Winsize) {
+		t.Helper()
+		deadline := time.Now().Add(time.Second)
+		for {
+			ws, err := childSlave.GetWinSize()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *ws == want {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("got %+v, want %+v", *ws, want)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	waitSize(Winsize{Row: 24, Col: 80})
+
+	resize := Winsize{Row: 50, Col: 132}
+	if err := hostMaster.SetWinSize(&resize); err != nil {
+		t.Fatal(err)
+	}
+	syscall.Kill(syscall.Getpid(), syscall.SIGWINCH)
+	waitSize(resize)
+
+	stop()
+	stop()
+	if err := hostMaster.SetWinSize(&Winsize{Row: 10, Col: 20}); err != nil {
+		t.Fatal(err)
+	}
+	syscall.Kill(syscall.Getpid(), syscall.SIGWINCH)
+	time.Sleep(50 * time.Millisecond)
+	waitSize(resize)
+}
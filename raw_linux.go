@@ -0,0 +1,62 @@
+package serial
+
+import (
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// MakeRawGuard puts the terminal fd, usually os.Stdin, in raw mode and returns
+// a function restoring the previous settings.
+// The settings are also restored when the process receives SIGINT or SIGTERM,
+// which is then raised again so that its default action terminates the process.
+// fd is not closed by MakeRawGuard or the restore function.
+func MakeRawGuard(fd int) (restore func() error, err error) {
+	return makeRawGuard("MakeRawGuard", fd, true)
+}
+
+// MakeRawGuardNoReraise is like MakeRawGuard, but does not raise the signal again
+// after restoring the settings. Use it in programs handling SIGINT or SIGTERM themselves
+// with signal.Notify, which are already sent the signal and would be sent it a second time.
+func MakeRawGuardNoReraise(fd int) (restore func() error, err error) {
+	return makeRawGuard("MakeRawGuardNoReraise", fd, false)
+}
+
+func makeRawGuard(op string, fd int, reraise bool) (restore func() error, err error) {
+	// Only the terminal ioctls are used, fd is neither switched to non-blocking mode nor closed.
+	p := &Port{options: NewOptions()}
+	p.f.Store(fd)
+	saved, err := p.GetAttr()
+	if err != nil {
+		return nil, wrapErr(op, err)
+	}
+	if err := p.MakeRaw(); err != nil {
+		return nil, wrapErr(op, err)
+	}
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	quit := make(chan struct{})
+	var once sync.Once
+	var restoreErr error
+	restore = func() error {
+		once.Do(func() {
+			signal.Stop(sig)
+			close(quit)
+			restoreErr = p.SetAttr(TCSANOW, saved)
+		})
+		return restoreErr
+	}
+	go func() {
+		select {
+		case s := <-sig:
+			restore()
+			if reraise {
+				syscall.Kill(syscall.Getpid(), s.(syscall.Signal))
+			}
+		case <-quit:
+		}
+	}()
+	return restore, nil
+}
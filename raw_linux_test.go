@@ -0,0 +1,106 @@
+package serial
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// TestMakeRawGuardChild is run as a child process on a pty by TestMakeRawGuard.
+func TestMakeRawGuardChild(t *testing.T) {
+	mode := os.Getenv("RAW_GUARD_CHILD")
+	if mode == "" {
+		t.Skip("only run by TestMakeRawGuard")
+	}
+	own := make(chan os.Signal, 2)
+	if mode == "handled" {
+		signal.Notify(own, syscall.SIGINT)
+	}
+	guard := MakeRawGuard
+	if mode == "handled" {
+		guard = MakeRawGuardNoReraise
+	}
+	restore, err := guard(0)
+	if err != nil {
+		os.Exit(2)
+	}
+	if mode == "restore" {
+		if restore() != nil || restore() != nil {
+			os.Exit(3)
+		}
+		// Neither StartCommand nor MakeRawGuard leave the terminal non-blocking.
+		if flags, _, _ := syscall.Syscall(syscall.SYS_FCNTL, 0, syscall.F_GETFL, 0); flags&syscall.O_NONBLOCK != 0 {
+			os.Exit(6)
+		}
+		os.Exit(0)
+	}
+	os.Stdout.WriteString("ready\n")
+	if mode == "handled" {
+		<-own
+		select {
+		case <-own:
+			os.Exit(4)
+		case <-time.After(200 * time.Millisecond):
+		}
+		os.Exit(0)
+	}
+	time.Sleep(5 * time.Second)
+	os.Exit(5)
+}
+
+func TestMakeRawGuard(t *testing.T) {
+	for _, mode := range []string{"restore", "reraise", "handled"} {
+		t.Run(mode, func(t *testing.T) {
+			cmd := exec.Command(os.Args[0], "-test.run=^TestMakeRawGuardChild$")
+			cmd.Env = append(os.Environ(), "RAW_GUARD_CHILD="+mode)
+			master, err := StartCommand(cmd, nil, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer master.Close()
+
+			if mode != "restore" {
+				var out []byte
+				buf := make([]byte, 256)
+				for !bytes.Contains(out, []byte("ready")) {
+					n, err := master.ReadTimeout(buf, 5*time.Second)
+					if err != nil {
+						t.Fatalf("waiting for the child: %v", err)
+					}
+					out = append(out, buf[:n]...)
+				}
+				attrs, err := master.GetAttr()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if attrs.Lflag&ICANON != 0 {
+					t.Fatal("terminal not in raw mode")
+				}
+				cmd.Process.Signal(os.Interrupt)
+			}
+
+			err = cmd.Wait()
+			var exit *exec.ExitError
+			if mode == "reraise" {
+				if !errors.As(err, &exit) || exit.Sys().(syscall.WaitStatus).Signal() != syscall.SIGINT {
+					t.Fatalf("got %v, want the child killed by SIGINT", err)
+				}
+			} else if err != nil {
+				t.Fatalf("child: %v", err)
+			}
+			// The slave is gone, but the master shares its settings.
+			attrs, err := master.GetAttr()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if attrs.Lflag&ICANON == 0 {
+				t.Fatal("terminal settings not restored")
+			}
+		})
+	}
+}
@@ -0,0 +1,123 @@
+// Package slip implements SLIP framing (RFC 1055) over an io.ReadWriter such as serial.Port.
+package slip
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"sync"
+)
+
+// Special characters
+const (
+	END     = byte(0xC0)
+	ESC     = byte(0xDB)
+	ESC_END = byte(0xDC)
+	ESC_ESC = byte(0xDD)
+)
+
+// DefaultMaxPacket is the packet size limit of a new Conn, the 1006 bytes used by Berkeley UNIX SLIP.
+const DefaultMaxPacket = 1006
+
+// ErrPacketTooLong is returned by ReadPacket for a packet larger than MaxPacket.
+// The rest of the packet is discarded, so the next ReadPacket returns the following one.
+var ErrPacketTooLong = errors.New("slip: packet too long")
+
+// Conn reads and writes SLIP packets.
+type Conn struct {
+	// MaxPacket is the largest packet ReadPacket accepts.
+	MaxPacket int
+	// LeadingEnd sends an END before each packet, flushing any line noise
+	// the receiver has accumulated into a packet of its own.
+	LeadingEnd bool
+
+	r   *bufio.Reader
+	w   io.Writer
+	wmu sync.Mutex
+	buf []byte
+}
+
+// NewConn returns a Conn on rw with MaxPacket set to DefaultMaxPacket.
+func NewConn(rw io.ReadWriter) *Conn {
+	return &Conn{
+		MaxPacket: DefaultMaxPacket,
+		r:         bufio.NewReader(rw),
+		w:         rw,
+	}
+}
+
+// ReadPacket returns the next non-empty packet.
+// It returns io.EOF if the reader ends between packets and io.ErrUnexpectedEOF within one.
+// The returned slice is only valid until the next call to ReadPacket.
+func (c *Conn) ReadPacket() ([]byte, error) {
+	c.buf = c.buf[:0]
+	tooLong := false
+	for {
+		b, err := c.r.ReadByte()
+		if err != nil {
+			if err == io.EOF && (len(c.buf) > 0 || tooLong) {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		switch b {
+		case END:
+			if tooLong {
+				return nil, ErrPacketTooLong
+			}
+			if len(c.buf) > 0 {
+				return c.buf, nil
+			}
+			continue
+		case ESC:
+			b, err = c.r.ReadByte()
+			if err != nil {
+				if err == io.EOF {
+					err = io.ErrUnexpectedEOF
+				}
+				return nil, err
+			}
+			switch b {
+			case ESC_END:
+				b = END
+			case ESC_ESC:
+				b = ESC
+			}
+			// Any other byte is a protocol violation, RFC 1055 suggests keeping it as is.
+		}
+		if len(c.buf) >= c.MaxPacket {
+			tooLong = true
+			continue
+		}
+		c.buf = append(c.buf, b)
+	}
+}
+
+// Encode appends the SLIP encoding of packet, terminated by END, to dst.
+func Encode(dst, packet []byte) []byte {
+	for _, b := range packet {
+		switch b {
+		case END:
+			dst = append(dst, ESC, ESC_END)
+		case ESC:
+			dst = append(dst, ESC, ESC_ESC)
+		default:
+			dst = append(dst, b)
+		}
+	}
+	return append(dst, END)
+}
+
+// WritePacket encodes packet and writes it with a single Write.
+// It is safe to call from multiple goroutines.
+func (c *Conn) WritePacket(packet []byte) error {
+	frame := make([]byte, 0, 2*len(packet)+2)
+	if c.LeadingEnd {
+		frame = append(frame, END)
+	}
+	frame = Encode(frame, packet)
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	_, err := c.w.Write(frame)
+	return err
+}
@@ -0,0 +1,109 @@
+package slip
+
+import (
+	"bytes"
+	"github.com/daedaluz/goserial/internal/ptytest"
+	"io"
+	"testing"
+)
+
+func TestEncode(t *testing.T) {
+	tests := []struct {
+		packet, frame []byte
+	}{
+		{[]byte("abc"), []byte{'a', 'b', 'c', END}},
+		{[]byte{END}, []byte{ESC, ESC_END, END}},
+		{[]byte{ESC}, []byte{ESC, ESC_ESC, END}},
+		{[]byte{1, END, ESC, ESC_END, 2}, []byte{1, ESC, ESC_END, ESC, ESC_ESC, ESC_END, 2, END}},
+		{nil, []byte{END}},
+	}
+	for _, tt := range tests {
+		if got := Encode(nil, tt.packet); !bytes.Equal(got, tt.frame) {
+			t.Errorf("Encode(% x) = % x, want % x", tt.packet, got, tt.frame)
+		}
+	}
+}
+
+func TestConnRoundTrip(t *testing.T) {
+	packets := [][]byte{{END}, {ESC}, []byte("hello"), bytes.Repeat([]byte{END, ESC, 0x00}, 300)}
+	for _, leadingEnd := range []bool{false, true} {
+		var line bytes.Buffer
+		c := NewConn(&line)
+		c.LeadingEnd = leadingEnd
+		for _, p := range packets {
+			if err := c.WritePacket(p); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if leadingEnd && line.Bytes()[0] != END {
+			t.Fatalf("no leading END: % x", line.Bytes()[:4])
+		}
+		for _, p := range packets {
+			got, err := c.ReadPacket()
+			if err != nil || !bytes.Equal(got, p) {
+				t.Fatalf("leading END %v: got % x, %v, want % x", leadingEnd, got, err, p)
+			}
+		}
+		if _, err := c.ReadPacket(); err != io.EOF {
+			t.Fatalf("got %v, want io.EOF", err)
+		}
+	}
+}
+
+func TestConnPacketTooLong(t *testing.T) {
+	var line bytes.Buffer
+	c := NewConn(&line)
+	c.MaxPacket = 4
+	// Escaped characters count once, so this packet fits.
+	c.WritePacket([]byte{END, ESC, END, ESC})
+	c.WritePacket([]byte("too long"))
+	c.WritePacket([]byte("next"))
+	// Line noise ends up in a packet of its own thanks to the leading END.
+	line.Write([]byte("~~"))
+	c.LeadingEnd = true
+	c.WritePacket([]byte("last"))
+
+	for _, want := range []struct {
+		packet []byte
+		err    error
+	}{
+		{[]byte{END, ESC, END, ESC}, nil},
+		{nil, ErrPacketTooLong},
+		{[]byte("next"), nil},
+		{[]byte("~~"), nil},
+		{[]byte("last"), nil},
+		{nil, io.EOF},
+	} {
+		got, err := c.ReadPacket()
+		if err != want.err || !bytes.Equal(got, want.packet) {
+			t.Fatalf("got %q, %v, want %q, %v", got, err, want.packet, want.err)
+		}
+	}
+}
+
+func TestConnUnexpectedEOF(t *testing.T) {
+	for _, input := range [][]byte{{'a'}, {'a', ESC}, {ESC}} {
+		c := NewConn(bytes.NewBuffer(input))
+		if _, err := c.ReadPacket(); err != io.ErrUnexpectedEOF {
+			t.Errorf("% x: got %v, want %v", input, err, io.ErrUnexpectedEOF)
+		}
+	}
+	// An oversized packet cut short is reported as such.
+	c := NewConn(bytes.NewBufferString("abc"))
+	c.MaxPacket = 2
+	if _, err := c.ReadPacket(); err != io.ErrUnexpectedEOF {
+		t.Errorf("got %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+}
+
+func TestConnOverPTY(t *testing.T) {
+	master, slave := ptytest.Pair(t)
+	sender, receiver := NewConn(master), NewConn(slave)
+	sender.LeadingEnd = true
+	packet := bytes.Repeat([]byte{END, 'x', ESC}, 200)
+	go sender.WritePacket(packet)
+	got, err := receiver.ReadPacket()
+	if err != nil || !bytes.Equal(got, packet) {
+		t.Fatalf("got %d bytes, %v", len(got), err)
+	}
+}
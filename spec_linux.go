@@ -0,0 +1,175 @@
+package serial
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Spec is a port specification of the form "[device:]baud[,framing][,flow]",
+// for example "/dev/ttyUSB0:115200,8E2,rtscts" or "9600,7O1".
+//
+// Framing is data bits (5-8), parity (N, O, E, M or S) and stop bits (1 or 2), defaulting to 8N1.
+// Flow is one of none, rtscts or xonxoff, defaulting to none.
+type Spec struct {
+	Device string
+	Config Config
+}
+
+var parityLetters = map[Parity]byte{
+	ParityNone:  'N',
+	ParityOdd:   'O',
+	ParityEven:  'E',
+	ParityMark:  'M',
+	ParitySpace: 'S',
+}
+
+var flowNames = map[FlowControl]string{
+	FlowNone:    "none",
+	FlowRTSCTS:  "rtscts",
+	FlowXONXOFF: "xonxoff",
+}
+
+// ParseSpec parses a port specification, see Spec.
+func ParseSpec(s string) (*Spec, error) {
+	spec := &Spec{Config: *NewConfig(0)}
+	settings := s
+	if i := strings.LastIndexByte(s, ':'); i >= 0 && isSettings(s[i+1:]) {
+		spec.Device, settings = s[:i], s[i+1:]
+	} else if !isSettings(s) {
+		spec.Device, settings = s, ""
+	}
+	if settings == "" {
+		return nil, wrapErr("ParseSpec", configErr("missing baud rate in %q", s))
+	}
+	fields := strings.Split(settings, ",")
+	baud, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return nil, wrapErr("ParseSpec", configErr("invalid baud rate %q", fields[0]))
+	}
+	spec.Config.BaudRate = baud
+	for _, field := range fields[1:] {
+		if err := spec.parseField(field); err != nil {
+			return nil, wrapErr("ParseSpec", err)
+		}
+	}
+	if err := spec.Config.Validate(); err != nil {
+		return nil, wrapErr("ParseSpec", err)
+	}
+	return spec, nil
+}
+
+// isSettings returns true if s looks like the settings part of a spec rather than a path.
+func isSettings(s string) bool {
+	if s == "" || !isDigit(s[0]) {
+		return false
+	}
+	for _, c := range s {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == ',') {
+			return false
+		}
+	}
+	return true
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func (s *Spec) parseField(field string) error {
+	for flow, name := range flowNames {
+		if strings.EqualFold(field, name) {
+			s.Config.FlowControl = flow
+			return nil
+		}
+	}
+	if len(field) != 3 || !isDigit(field[0]) || !isDigit(field[2]) {
+		return configErr("invalid field %q", field)
+	}
+	s.Config.DataBits = int(field[0] - '0')
+	parity := strings.ToUpper(field[1:2])[0]
+	found := false
+	for p, letter := range parityLetters {
+		if letter == parity {
+			s.Config.Parity = p
+			found = true
+		}
+	}
+	if !found {
+		return configErr("invalid parity %q", field[1:2])
+	}
+	s.Config.StopBits = int(field[2] - '0')
+	return nil
+}
+
+// defaultCc holds the control characters the kernel initialises terminals with.
+var defaultCc = [19]byte{
+	VINTR:    003,
+	VQUIT:    034,
+	VERASE:   0177,
+	VKILL:    025,
+	VEOF:     004,
+	VTIME:    0,
+	VMIN:     1,
+	VSTART:   021,
+	VSTOP:    023,
+	VSUSP:    032,
+	VREPRINT: 022,
+	VDISCARD: 017,
+	VWERASE:  027,
+	VLNEXT:   026,
+}
+
+// Termios2 returns fully populated raw mode settings for the Spec.
+// Standard speeds use the matching B constant, others use BOTHER.
+// The control characters are the kernel defaults, so xonxoff uses ^Q/^S.
+func (s *Spec) Termios2() (*Termios2, error) {
+	attrs := &Termios2{Cflag: CREAD | CLOCAL, Cc: defaultCc}
+	attrs.MakeRaw()
+	if err := s.Config.Apply(attrs); err != nil {
+		return nil, err
+	}
+	return attrs, nil
+}
+
+// String formats the Spec, omitting the device if empty and the flow control if none.
+func (s *Spec) String() string {
+	c := &s.Config
+	settings := fmt.Sprintf("%d,%d%c%d", c.BaudRate, c.DataBits, parityLetters[c.Parity], c.StopBits)
+	if c.FlowControl != FlowNone {
+		settings += "," + flowNames[c.FlowControl]
+	}
+	if s.Device == "" {
+		return settings
+	}
+	return s.Device + ":" + settings
+}
+
+// SpecFromTermios2 returns the Spec matching device and attrs.
+func SpecFromTermios2(device string, attrs *Termios2) *Spec {
+	return &Spec{Device: device, Config: *ConfigFromTermios2(attrs)}
+}
+
+// OpenSpec opens the device of the port specification s and applies its settings.
+func OpenSpec(s string, opts *Options) (*Port, error) {
+	spec, err := ParseSpec(s)
+	if err != nil {
+		return nil, err
+	}
+	if spec.Device == "" {
+		return nil, wrapErr("OpenSpec", configErr("missing device in %q", s))
+	}
+	attrs, err := spec.Termios2()
+	if err != nil {
+		return nil, wrapErr("OpenSpec", err)
+	}
+	p, err := Open(spec.Device, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.SetAttr2(TCSANOW, attrs); err != nil {
+		p.Close()
+		return nil, wrapErr("OpenSpec", err)
+	}
+	return p, nil
+}
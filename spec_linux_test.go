@@ -0,0 +1,23 @@
+package serial
+
+import "testing"
+
+func TestSpecTermios2ControlChars(t *testing.T) {
+	spec, err := ParseSpec("/dev/ttyUSB0:115200,8N1,xonxoff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	attrs, err := spec.Termios2()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attrs.Iflag&(IXON|IXOFF) != IXON|IXOFF {
+		t.Fatalf("Iflag %#o lacks IXON|IXOFF", attrs.Iflag)
+	}
+	if attrs.Cc[VSTART] != 0x11 || attrs.Cc[VSTOP] != 0x13 {
+		t.Fatalf("VSTART %#x, VSTOP %#x, want 0x11, 0x13", attrs.Cc[VSTART], attrs.Cc[VSTOP])
+	}
+	if attrs.Cc[VINTR] != 0x03 || attrs.Cc[VEOF] != 0x04 {
+		t.Fatalf("VINTR %#x, VEOF %#x, want 0x03, 0x04", attrs.Cc[VINTR], attrs.Cc[VEOF])
+	}
+}
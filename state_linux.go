@@ -0,0 +1,59 @@
+package serial
+
+// PortState is a snapshot of the settings of a Port.
+// Settings the driver does not support, such as RS485 or modem lines on a
+// pseudo-terminal, are nil.
+type PortState struct {
+	Termios2   *Termios2
+	RS485      *RS485
+	Serial     *Serial
+	ModemLines *ModemLine
+}
+
+// modemOutputLines are the modem lines that can be set with SetModemLines.
+const modemOutputLines = TIOCM_DTR | TIOCM_RTS | TIOCM_OUT1 | TIOCM_OUT2 | TIOCM_LOOP
+
+// SaveState captures the termios2, RS485, serial and modem line settings of the Port.
+// Only a failure to read the termios2 settings is reported as an error.
+func (p *Port) SaveState() (*PortState, error) {
+	attrs, err := p.GetAttr2()
+	if err != nil {
+		return nil, wrapErr("SaveState", err)
+	}
+	state := &PortState{Termios2: attrs}
+	if rs485, err := p.GetRS485(); err == nil {
+		state.RS485 = rs485
+	}
+	if serial, err := p.GetSerial(); err == nil {
+		state.Serial = serial
+	}
+	if lines, err := p.GetModemLines(); err == nil {
+		state.ModemLines = &lines
+	}
+	return state, nil
+}
+
+// RestoreState applies a snapshot taken by SaveState.
+// All settings present in the snapshot are restored, even if one of them fails,
+// and the first error is returned.
+func (p *Port) RestoreState(state *PortState) error {
+	var first error
+	keep := func(err error) {
+		if first == nil && err != nil {
+			first = wrapErr("RestoreState", err)
+		}
+	}
+	if state.Serial != nil {
+		keep(p.SetSerial(state.Serial))
+	}
+	if state.RS485 != nil {
+		keep(p.SetRS485(state.RS485))
+	}
+	if state.Termios2 != nil {
+		keep(p.SetAttr2(TCSANOW, state.Termios2))
+	}
+	if state.ModemLines != nil {
+		keep(p.SetModemLines(*state.ModemLines & modemOutputLines))
+	}
+	return first
+}
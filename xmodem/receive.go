@@ -0,0 +1,145 @@
+package xmodem
+
+import (
+	"context"
+	"errors"
+	serial "github.com/daedaluz/goserial"
+	"io"
+)
+
+// crcAttempts is how many times a receiver requests CRC-16 blocks
+// before falling back to checksums.
+const crcAttempts = 3
+
+// errBadBlock is returned by readValidBlock for a corrupted block.
+var errBadBlock = errors.New("xmodem: bad block")
+
+// Receive receives a file over port into w and returns the number of bytes written.
+// The padding of the last block is written to w as well.
+// If ctx is done, the transfer is canceled on both ends.
+func Receive(ctx context.Context, port *serial.Port, w io.Writer, opts *Options) (int64, error) {
+	c := newConn(ctx, port, opts)
+	start := CRC
+	if c.opts.Mode == ModeChecksum {
+		start = NAK
+	}
+	n, err := c.receiveData(w, start)
+	if err != nil {
+		return n, c.fail(err)
+	}
+	return n, nil
+}
+
+// readValidBlock reads a block like readBlock, discarding the rest of
+// a corrupted block and returning errBadBlock for it.
+func (c *conn) readValidBlock(header byte) (byte, []byte, error) {
+	seq, data, ok, err := c.readBlock(header)
+	if err != nil {
+		return 0, nil, err
+	}
+	if !ok {
+		if err := c.purge(); err != nil {
+			return 0, nil, err
+		}
+		return 0, nil, errBadBlock
+	}
+	return seq, data, nil
+}
+
+// receiveBlock waits for block seq, calling request with the error after
+// a timeout or a corrupted block to ask for it again, or to give up if it
+// returns an error. A repeat of the previous block is acknowledged and skipped.
+// It returns nil data when the sender ends the file with EOT.
+func (c *conn) receiveBlock(seq byte, request func(err error) error) ([]byte, error) {
+	for tries := 0; ; {
+		b, err := c.readByte(c.opts.Timeout)
+		switch {
+		case err != nil:
+		case b == SOH || b == STX:
+			var n byte
+			var data []byte
+			if n, data, err = c.readValidBlock(b); err != nil {
+				break
+			}
+			if n == seq {
+				return data, nil
+			}
+			if n != seq-1 {
+				return nil, ErrSequence
+			}
+			// The ACK of the previous block was lost.
+			if err := c.write(ACK); err != nil {
+				return nil, err
+			}
+			continue
+		case b == EOT:
+			return nil, nil
+		case b == CAN:
+			if b, err := c.readByte(c.opts.CharTimeout); err == nil && b == CAN {
+				return nil, ErrCanceled
+			}
+			continue
+		default:
+			continue
+		}
+		if !isTimeout(err) && err != errBadBlock {
+			return nil, err
+		}
+		if tries++; tries > c.opts.Retries {
+			return nil, ErrRetries
+		}
+		if err := request(err); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// receiveData receives blocks numbered from 1 until EOT, requesting
+// the transfer with start, which is one of NAK, CRC or G.
+func (c *conn) receiveData(w io.Writer, start byte) (int64, error) {
+	var total int64
+	seq := byte(1)
+	started := false
+	attempts := 0
+	request := func(err error) error {
+		if started {
+			if c.stream {
+				// Streaming has no retransmissions.
+				return err
+			}
+			return c.write(NAK)
+		}
+		if attempts++; start == CRC && attempts > crcAttempts {
+			start = NAK
+		}
+		c.crc = start != NAK
+		c.stream = start == G
+		return c.write(start)
+	}
+	if err := request(nil); err != nil {
+		return 0, err
+	}
+	for {
+		data, err := c.receiveBlock(seq, request)
+		if err != nil {
+			return total, err
+		}
+		if data == nil {
+			return total, c.write(ACK)
+		}
+		started = true
+		if _, err := w.Write(data); err != nil {
+			return total, err
+		}
+		seq++
+		total += int64(len(data))
+		if c.opts.Progress != nil {
+			c.opts.Progress(total)
+		}
+		if !c.stream {
+			if err := c.write(ACK); err != nil {
+				return total, err
+			}
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package xmodem
+
+import (
+	"context"
+	serial "github.com/daedaluz/goserial"
+	"io"
+)
+
+// Send sends the contents of r over port and returns the number of bytes sent.
+// The last block is padded with SUB characters, which the receiver cannot tell from data.
+// If ctx is done, the transfer is canceled on both ends.
+func Send(ctx context.Context, port *serial.Port, r io.Reader, opts *Options) (int64, error) {
+	c := newConn(ctx, port, opts)
+	if err := c.waitStart(); err != nil {
+		return 0, c.fail(err)
+	}
+	n, err := c.sendData(r, 1, c.opts.Mode == Mode1K)
+	if err != nil {
+		return n, c.fail(err)
+	}
+	if err := c.sendEOT(); err != nil {
+		return n, c.fail(err)
+	}
+	return n, nil
+}
+
+// waitStart waits for the receiver to request a transfer and
+// selects checksums, CRC-16 or streaming accordingly.
+func (c *conn) waitStart() error {
+	cans := 0
+	for tries := 0; tries <= c.opts.Retries; {
+		b, err := c.readByte(c.opts.Timeout)
+		if isTimeout(err) {
+			tries++
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		switch b {
+		case NAK, CRC, G:
+			c.crc = b != NAK
+			c.stream = b == G
+			return nil
+		case CAN:
+			if cans++; cans == 2 {
+				return ErrCanceled
+			}
+		default:
+			cans = 0
+		}
+	}
+	return ErrRetries
+}
+
+// response waits for the receiver to answer a block, returning ACK, NAK, CRC or G.
+func (c *conn) response() (byte, error) {
+	cans := 0
+	for {
+		b, err := c.readByte(c.opts.Timeout)
+		if err != nil {
+			return 0, err
+		}
+		switch b {
+		case ACK, NAK, CRC, G:
+			return b, nil
+		case CAN:
+			if cans++; cans == 2 {
+				return 0, ErrCanceled
+			}
+		default:
+			cans = 0
+		}
+	}
+}
+
+// sendBlock sends a block until it is acknowledged.
+// In streaming mode, blocks are sent once without waiting.
+func (c *conn) sendBlock(seq byte, data []byte) error {
+	block := c.encodeBlock(seq, data)
+	for tries := 0; tries <= c.opts.Retries; tries++ {
+		if err := c.write(block...); err != nil {
+			return err
+		}
+		if c.stream {
+			return nil
+		}
+		resp, err := c.response()
+		if isTimeout(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if resp == ACK {
+			return nil
+		}
+	}
+	return ErrRetries
+}
+
+// sendData sends the contents of r in blocks numbered from seq.
+// 1K blocks are used if big is set, except for a short final block.
+func (c *conn) sendData(r io.Reader, seq byte, big bool) (int64, error) {
+	size := 128
+	if big && c.crc {
+		size = 1024
+	}
+	buf := make([]byte, size)
+	var total int64
+	for {
+		n, err := io.ReadFull(r, buf)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return total, err
+		}
+		for off := 0; off < n; {
+			block := make([]byte, size)
+			if n-off < size {
+				block = block[:128]
+			}
+			m := copy(block, buf[off:n])
+			for i := m; i < len(block); i++ {
+				block[i] = SUB
+			}
+			if err := c.sendBlock(seq, block); err != nil {
+				return total, err
+			}
+			seq++
+			off += m
+			total += int64(m)
+			if c.opts.Progress != nil {
+				c.opts.Progress(total)
+			}
+		}
+		if err != nil {
+			return total, nil
+		}
+	}
+}
+
+// sendEOT ends the file.
+func (c *conn) sendEOT() error {
+	for tries := 0; tries <= c.opts.Retries; tries++ {
+		if err := c.write(EOT); err != nil {
+			return err
+		}
+		resp, err := c.response()
+		if isTimeout(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if resp == ACK {
+			return nil
+		}
+	}
+	return ErrRetries
+}
@@ -0,0 +1,237 @@
+// Package xmodem implements the XMODEM file transfer protocol over serial.Port,
+// with the checksum, CRC and 1K variants, and YMODEM batch transfers.
+package xmodem
+
+import (
+	"context"
+	"errors"
+	serial "github.com/daedaluz/goserial"
+	"github.com/daedaluz/goserial/internal/crc"
+	"github.com/daedaluz/goserial/internal/portio"
+	"time"
+)
+
+// Control characters
+const (
+	SOH = byte(0x01)
+	STX = byte(0x02)
+	EOT = byte(0x04)
+	ACK = byte(0x06)
+	NAK = byte(0x15)
+	CAN = byte(0x18)
+	// CRC is sent by the receiver instead of NAK to request CRC-16 blocks.
+	CRC = byte('C')
+	// G is sent by a YMODEM-G receiver to request CRC-16 blocks without acknowledgements.
+	G = byte('G')
+	// SUB pads the last block.
+	SUB = byte(0x1A)
+)
+
+// Mode is the XMODEM variant.
+type Mode int
+
+const (
+	// ModeChecksum uses 128 byte blocks with an 8 bit checksum.
+	ModeChecksum = Mode(iota)
+	// ModeCRC uses 128 byte blocks with a CRC-16.
+	ModeCRC
+	// Mode1K uses 1024 byte blocks with a CRC-16, falling back to 128 byte
+	// blocks for a short final block.
+	Mode1K
+)
+
+func (m Mode) String() string {
+	switch m {
+	case ModeChecksum:
+		return "XMODEM"
+	case ModeCRC:
+		return "XMODEM-CRC"
+	case Mode1K:
+		return "XMODEM-1K"
+	}
+	return "Unknown"
+}
+
+var (
+	// ErrCanceled is returned when the remote end cancels the transfer.
+	ErrCanceled = errors.New("xmodem: transfer canceled by remote")
+	// ErrRetries is returned when a block could not be transferred within the retry limit.
+	ErrRetries = errors.New("xmodem: too many retries")
+	// ErrSequence is returned by receivers when a block arrives out of sequence.
+	ErrSequence = errors.New("xmodem: block out of sequence")
+)
+
+// Protocol defaults
+const (
+	DefaultTimeout     = 10 * time.Second
+	DefaultCharTimeout = time.Second
+	DefaultRetries     = 10
+)
+
+// Options control a transfer. A nil *Options uses the defaults.
+type Options struct {
+	// Mode is the variant a receiver requests. A sender follows the checksum
+	// or CRC choice of the receiver and uses 1K blocks only with Mode1K.
+	Mode Mode
+	// Timeout is how long to wait for a block or a response.
+	Timeout time.Duration
+	// CharTimeout is how long to wait for each character within a block.
+	CharTimeout time.Duration
+	// Retries is how many times a block, or the start of the transfer, is retried.
+	Retries int
+	// Streaming makes a YMODEM receiver request YMODEM-G, where blocks are not
+	// acknowledged and any error aborts the transfer. Only use it on reliable links.
+	Streaming bool
+	// Progress, if set, is called with the number of bytes of the current file
+	// transferred so far after every block.
+	Progress func(n int64)
+}
+
+// NewOptions returns Options with the defaults for mode.
+func NewOptions(mode Mode) *Options {
+	return &Options{
+		Mode:        mode,
+		Timeout:     DefaultTimeout,
+		CharTimeout: DefaultCharTimeout,
+		Retries:     DefaultRetries,
+	}
+}
+
+// conn is one side of a transfer.
+type conn struct {
+	ctx  context.Context
+	port *serial.Port
+	opts *Options
+	buf  [1]byte
+	// crc selects CRC-16 blocks instead of checksums.
+	crc bool
+	// stream sends data blocks without waiting for acknowledgements.
+	stream bool
+}
+
+func newConn(ctx context.Context, port *serial.Port, opts *Options) *conn {
+	if opts == nil {
+		opts = NewOptions(ModeCRC)
+	}
+	return &conn{ctx: ctx, port: port, opts: opts}
+}
+
+// read reads into data using the protocol timeout, see portio.Read.
+func (c *conn) read(data []byte, timeout time.Duration) (int, error) {
+	return portio.Read(c.ctx, c.port, data, timeout)
+}
+
+func (c *conn) readByte(timeout time.Duration) (byte, error) {
+	if _, err := c.read(c.buf[:], timeout); err != nil {
+		return 0, err
+	}
+	return c.buf[0], nil
+}
+
+// readFull reads all of data, allowing CharTimeout between characters.
+func (c *conn) readFull(data []byte) error {
+	for n := 0; n < len(data); {
+		x, err := c.read(data[n:], c.opts.CharTimeout)
+		if err != nil {
+			return err
+		}
+		n += x
+	}
+	return nil
+}
+
+func (c *conn) write(data ...byte) error {
+	_, err := c.port.Write(data)
+	return err
+}
+
+// purge discards input until the line has been quiet for CharTimeout.
+func (c *conn) purge() error {
+	buf := make([]byte, 1024)
+	for {
+		_, err := c.read(buf, c.opts.CharTimeout)
+		if errors.Is(err, serial.ErrTimeout) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// cancel tells the remote end to abort the transfer.
+func (c *conn) cancel() {
+	c.port.Write([]byte{CAN, CAN, CAN})
+}
+
+// fail aborts the transfer for err, telling the remote end unless it canceled itself.
+func (c *conn) fail(err error) error {
+	if err != ErrCanceled {
+		c.cancel()
+	}
+	if ctxErr := c.ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+	return err
+}
+
+// isTimeout returns true if err is a protocol timeout.
+func isTimeout(err error) bool {
+	return errors.Is(err, serial.ErrTimeout)
+}
+
+// CRC16 returns the CRC-16 used by XMODEM (polynomial 0x1021, initial value 0).
+func CRC16(data []byte) uint16 {
+	return crc.CRC16(data)
+}
+
+func checksum(data []byte) byte {
+	var sum byte
+	for _, b := range data {
+		sum += b
+	}
+	return sum
+}
+
+// encodeBlock returns the block with sequence number seq carrying data,
+// which must be 128 or 1024 bytes long.
+func (c *conn) encodeBlock(seq byte, data []byte) []byte {
+	block := make([]byte, 0, len(data)+5)
+	header := SOH
+	if len(data) == 1024 {
+		header = STX
+	}
+	block = append(block, header, seq, ^seq)
+	block = append(block, data...)
+	if c.crc {
+		sum := CRC16(data)
+		return append(block, byte(sum>>8), byte(sum))
+	}
+	return append(block, checksum(data))
+}
+
+// readBlock reads the remainder of a block whose header byte has been read,
+// returning its sequence number and data.
+func (c *conn) readBlock(header byte) (byte, []byte, bool, error) {
+	size := 128
+	if header == STX {
+		size = 1024
+	}
+	trailer := 1
+	if c.crc {
+		trailer = 2
+	}
+	block := make([]byte, 2+size+trailer)
+	if err := c.readFull(block); err != nil {
+		return 0, nil, false, err
+	}
+	seq, data := block[0], block[2:2+size]
+	ok := block[1] == ^seq
+	if c.crc {
+		sum := CRC16(data)
+		ok = ok && block[2+size] == byte(sum>>8) && block[3+size] == byte(sum)
+	} else {
+		ok = ok && block[2+size] == checksum(data)
+	}
+	return seq, data, ok, nil
+}
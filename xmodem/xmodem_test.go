@@ -0,0 +1,244 @@
+package xmodem
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/daedaluz/goserial/internal/ptytest"
+	"io"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func testOptions(mode Mode) *Options {
+	opts := NewOptions(mode)
+	opts.Timeout = 2 * time.Second
+	opts.CharTimeout = 500 * time.Millisecond
+	return opts
+}
+
+func testData(n int) []byte {
+	data := make([]byte, n)
+	rand.New(rand.NewSource(int64(n))).Read(data)
+	return data
+}
+
+func TestTransfer(t *testing.T) {
+	for _, mode := range []Mode{ModeChecksum, ModeCRC, Mode1K} {
+		t.Run(mode.String(), func(t *testing.T) {
+			master, slave := ptytest.Pair(t)
+			data := testData(5000)
+
+			type result struct {
+				n   int64
+				err error
+			}
+			sent := make(chan result, 1)
+			var progress int64
+			go func() {
+				opts := testOptions(mode)
+				opts.Progress = func(n int64) { progress = n }
+				n, err := Send(context.Background(), master, bytes.NewReader(data), opts)
+				sent <- result{n, err}
+			}()
+			var received bytes.Buffer
+			n, err := Receive(context.Background(), slave, &received, testOptions(mode))
+			if err != nil {
+				t.Fatalf("Receive: %v", err)
+			}
+			s := <-sent
+			if s.err != nil || s.n != int64(len(data)) || progress != s.n {
+				t.Fatalf("Send: %d, %v, progress %d", s.n, s.err, progress)
+			}
+			if n != int64(received.Len()) || n%128 != 0 {
+				t.Fatalf("Receive: returned %d, wrote %d", n, received.Len())
+			}
+			if !bytes.Equal(received.Bytes()[:len(data)], data) {
+				t.Fatal("received data differs")
+			}
+			if pad := received.Bytes()[len(data):]; len(bytes.Trim(pad, string(SUB))) != 0 {
+				t.Fatalf("padding % x", pad)
+			}
+		})
+	}
+}
+
+func TestReceiveCanceled(t *testing.T) {
+	_, slave := ptytest.Pair(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := Receive(ctx, slave, io.Discard, testOptions(ModeCRC))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, want context.DeadlineExceeded", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("returned after %v", d)
+	}
+}
+
+func TestSendCanceled(t *testing.T) {
+	master, slave := ptytest.Pair(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		_, err := Send(ctx, master, bytes.NewReader(testData(100000)), testOptions(ModeCRC))
+		done <- err
+	}()
+
+	// Acknowledge the first block, then cancel the sender.
+	if _, err := slave.Write([]byte{CRC}); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 133)
+	for n := 0; n < len(buf); {
+		x, err := slave.ReadTimeout(buf[n:], time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		n += x
+	}
+	cancel()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("got %v, want context.Canceled", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Send did not return")
+	}
+	// The receiver is told to abort.
+	n, _ := slave.ReadTimeout(buf, time.Second)
+	if !bytes.Contains(buf[:n], []byte{CAN, CAN}) {
+		t.Fatalf("got % x, want CAN CAN", buf[:n])
+	}
+}
+
+func TestReceiveHangup(t *testing.T) {
+	master, slave := ptytest.Pair(t)
+	time.AfterFunc(100*time.Millisecond, func() { master.Close() })
+	start := time.Now()
+	_, err := Receive(context.Background(), slave, io.Discard, testOptions(ModeCRC))
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("got %v, want io.ErrUnexpectedEOF", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("returned after %v", d)
+	}
+}
+
+func TestHeader(t *testing.T) {
+	mtime := time.Unix(1700000000, 0)
+	block, err := encodeHeader(&File{Name: "dir/file.bin", Size: 3000, ModTime: mtime})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "dir/file.bin\x003000 14524770400\x00"; len(block) != 128 || string(block[:len(want)]) != want {
+		t.Fatalf("got %q", block)
+	}
+	f, err := decodeHeader(block)
+	if err != nil || f.Name != "dir/file.bin" || f.Size != 3000 || !f.ModTime.Equal(mtime) {
+		t.Fatalf("got %+v, %v", f, err)
+	}
+
+	block, _ = encodeHeader(&File{Name: "unknown", Size: -1, ModTime: mtime})
+	if f, err := decodeHeader(block); err != nil || f.Size != -1 || !f.ModTime.IsZero() {
+		t.Fatalf("got %+v, %v", f, err)
+	}
+	if _, err := encodeHeader(&File{Name: string(make([]byte, 1023)), Size: -1}); err != ErrNameTooLong {
+		t.Fatalf("got %v, want %v", err, ErrNameTooLong)
+	}
+	if f, err := decodeHeader(make([]byte, 128)); f != nil || err != nil {
+		t.Fatalf("end of batch: got %+v, %v", f, err)
+	}
+	if _, err := decodeHeader([]byte("name\x00big\x00")); err == nil {
+		t.Fatal("invalid size accepted")
+	}
+}
+
+func TestBatch(t *testing.T) {
+	for _, streaming := range []bool{false, true} {
+		name := "YMODEM"
+		if streaming {
+			name = "YMODEM-G"
+		}
+		t.Run(name, func(t *testing.T) {
+			master, slave := ptytest.Pair(t)
+			mtime := time.Unix(1700000000, 0)
+			contents := [][]byte{testData(3000), testData(1030), testData(200)}
+			files := []*File{
+				{Name: "a.bin", Size: 3000, ModTime: mtime, Reader: bytes.NewReader(contents[0])},
+				{Name: "dir/b.bin", Size: 1030, Reader: bytes.NewReader(contents[1])},
+				{Name: "c.bin", Size: -1, Reader: bytes.NewReader(contents[2])},
+			}
+			sent := make(chan error, 1)
+			go func() {
+				sent <- SendBatch(context.Background(), master, files, testOptions(Mode1K))
+			}()
+
+			opts := testOptions(Mode1K)
+			opts.Streaming = streaming
+			var received []*bytes.Buffer
+			got, err := ReceiveBatch(context.Background(), slave, func(f *File) (io.Writer, error) {
+				received = append(received, new(bytes.Buffer))
+				return received[len(received)-1], nil
+			}, opts)
+			if err != nil {
+				t.Fatalf("ReceiveBatch: %v", err)
+			}
+			if err := <-sent; err != nil {
+				t.Fatalf("SendBatch: %v", err)
+			}
+			if len(got) != len(files) {
+				t.Fatalf("received %d files, want %d", len(got), len(files))
+			}
+			for i, f := range got {
+				if f.Name != files[i].Name || f.Size != files[i].Size || !f.ModTime.Equal(files[i].ModTime) {
+					t.Fatalf("file %d: got %+v, want %+v", i, f, files[i])
+				}
+			}
+			// Files of known size are truncated to it, the last one keeps its padding.
+			for i, data := range contents[:2] {
+				if !bytes.Equal(received[i].Bytes(), data) {
+					t.Fatalf("file %d: received %d bytes, want %d", i, received[i].Len(), len(data))
+				}
+			}
+			last := received[2].Bytes()
+			if len(last)%128 != 0 || len(last) < 200 || !bytes.Equal(last[:200], contents[2]) || len(bytes.Trim(last[200:], string(SUB))) != 0 {
+				t.Fatalf("file 2: received %d bytes", len(last))
+			}
+		})
+	}
+}
+
+func TestSendBatchEnd(t *testing.T) {
+	master, slave := ptytest.Pair(t)
+	sent := make(chan error, 1)
+	go func() {
+		sent <- SendBatch(context.Background(), master, nil, testOptions(Mode1K))
+	}()
+	if _, err := slave.Write([]byte{CRC}); err != nil {
+		t.Fatal(err)
+	}
+	// An empty block 0 ends the batch.
+	block := make([]byte, 133)
+	for n := 0; n < len(block); {
+		x, err := slave.ReadTimeout(block[n:], time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		n += x
+	}
+	crc := CRC16(make([]byte, 128))
+	want := append(append([]byte{SOH, 0x00, 0xFF}, make([]byte, 128)...), byte(crc>>8), byte(crc))
+	if !bytes.Equal(block, want) {
+		t.Fatalf("got % x", block)
+	}
+	if _, err := slave.Write([]byte{ACK}); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-sent; err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,206 @@
+package xmodem
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	serial "github.com/daedaluz/goserial"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrNameTooLong is returned by SendBatch for a file whose name and
+// metadata do not fit in a 1K block.
+var ErrNameTooLong = errors.New("xmodem: file name too long")
+
+// File describes a file of a YMODEM batch.
+type File struct {
+	// Name is the file name, using '/' as separator. Received names come
+	// from the remote end and must be sanitized before use as a path.
+	Name string
+	// Size in bytes, -1 if unknown. Receivers truncate the padding of the last block to it.
+	Size int64
+	// ModTime is the modification time, zero if unknown.
+	ModTime time.Time
+	// Reader supplies the contents of the file when sending.
+	Reader io.Reader
+}
+
+// encodeHeader returns block 0 describing f: the name, a NUL,
+// the decimal size and the octal modification time in seconds.
+func encodeHeader(f *File) ([]byte, error) {
+	var meta string
+	if f.Size >= 0 {
+		meta = strconv.FormatInt(f.Size, 10)
+		if !f.ModTime.IsZero() {
+			meta += " " + strconv.FormatInt(f.ModTime.Unix(), 8)
+		}
+	}
+	n := len(f.Name) + 1 + len(meta) + 1
+	if f.Name == "" || n > 1024 {
+		return nil, ErrNameTooLong
+	}
+	size := 128
+	if n > size {
+		size = 1024
+	}
+	block := make([]byte, size)
+	copy(block, f.Name)
+	copy(block[len(f.Name)+1:], meta)
+	return block, nil
+}
+
+// decodeHeader parses block 0, returning nil for the empty block ending a batch.
+func decodeHeader(block []byte) (*File, error) {
+	name := block
+	if i := bytes.IndexByte(block, 0); i >= 0 {
+		name, block = block[:i], block[i+1:]
+	} else {
+		block = nil
+	}
+	if len(name) == 0 {
+		return nil, nil
+	}
+	f := &File{Name: string(name), Size: -1}
+	if i := bytes.IndexByte(block, 0); i >= 0 {
+		block = block[:i]
+	}
+	fields := strings.Fields(string(block))
+	if len(fields) > 0 {
+		size, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("xmodem: invalid file size %q", fields[0])
+		}
+		f.Size = size
+	}
+	if len(fields) > 1 {
+		mtime, err := strconv.ParseInt(fields[1], 8, 64)
+		if err != nil {
+			return nil, fmt.Errorf("xmodem: invalid modification time %q", fields[1])
+		}
+		if mtime != 0 {
+			f.ModTime = time.Unix(mtime, 0)
+		}
+	}
+	return f, nil
+}
+
+// SendBatch sends files over port with YMODEM, using 1K blocks and CRC-16,
+// or YMODEM-G if the receiver requests it.
+// If ctx is done, the transfer is canceled on both ends.
+func SendBatch(ctx context.Context, port *serial.Port, files []*File, opts *Options) error {
+	c := newConn(ctx, port, opts)
+	for _, f := range files {
+		header, err := encodeHeader(f)
+		if err != nil {
+			return c.fail(err)
+		}
+		if err := c.waitStart(); err != nil {
+			return c.fail(err)
+		}
+		// Block 0 is acknowledged even in streaming mode.
+		c.stream = false
+		if err := c.sendBlock(0, header); err != nil {
+			return c.fail(err)
+		}
+		if err := c.waitStart(); err != nil {
+			return c.fail(err)
+		}
+		if _, err := c.sendData(f.Reader, 1, true); err != nil {
+			return c.fail(err)
+		}
+		if err := c.sendEOT(); err != nil {
+			return c.fail(err)
+		}
+	}
+	if err := c.waitStart(); err != nil {
+		return c.fail(err)
+	}
+	c.stream = false
+	if err := c.sendBlock(0, make([]byte, 128)); err != nil {
+		return c.fail(err)
+	}
+	return nil
+}
+
+// ReceiveBatch receives files over port with YMODEM, or YMODEM-G if
+// opts.Streaming is set, until the sender ends the batch.
+// For each file, create is called with its metadata and returns where to write the contents,
+// which are truncated to the size of the file if known.
+// It returns the files received completely.
+// If ctx is done, the transfer is canceled on both ends.
+func ReceiveBatch(ctx context.Context, port *serial.Port, create func(f *File) (io.Writer, error), opts *Options) ([]*File, error) {
+	c := newConn(ctx, port, opts)
+	start := CRC
+	if c.opts.Streaming {
+		start = G
+	}
+	var files []*File
+	for {
+		f, err := c.receiveHeader(start)
+		if err != nil {
+			return files, c.fail(err)
+		}
+		if f == nil {
+			return files, nil
+		}
+		w, err := create(f)
+		if err != nil {
+			return files, c.fail(err)
+		}
+		if _, err := c.receiveData(&limitWriter{w: w, n: f.Size}, start); err != nil {
+			return files, c.fail(err)
+		}
+		files = append(files, f)
+	}
+}
+
+// receiveHeader requests and receives block 0 with start.
+func (c *conn) receiveHeader(start byte) (*File, error) {
+	c.crc, c.stream = true, false
+	request := func(error) error {
+		return c.write(start)
+	}
+	if err := request(nil); err != nil {
+		return nil, err
+	}
+	for {
+		block, err := c.receiveBlock(0, request)
+		if err != nil {
+			return nil, err
+		}
+		if err := c.write(ACK); err != nil {
+			return nil, err
+		}
+		// A repeated EOT means the ACK of the previous one was lost.
+		if block != nil {
+			return decodeHeader(block)
+		}
+	}
+}
+
+// limitWriter writes at most n bytes to w and discards the rest, n < 0 means no limit.
+type limitWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (l *limitWriter) Write(data []byte) (int, error) {
+	size := len(data)
+	if l.n >= 0 {
+		if int64(len(data)) > l.n {
+			data = data[:l.n]
+		}
+		l.n -= int64(len(data))
+	}
+	if len(data) == 0 {
+		return size, nil
+	}
+	if _, err := l.w.Write(data); err != nil {
+		return 0, err
+	}
+	return size, nil
+}
@@ -0,0 +1,327 @@
+package zmodem
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	serial "github.com/daedaluz/goserial"
+	"github.com/daedaluz/goserial/internal/portio"
+	"time"
+)
+
+// maxGarbage is how many characters may precede a header before giving up on it,
+// enough for the data a sender streams before it notices a ZRPOS.
+const maxGarbage = 2*MaxBlockSize + 1400
+
+// abortSequence cancels a session at the remote end.
+var abortSequence = []byte{can, can, can, can, can, can, can, can, 8, 8, 8, 8, 8, 8, 8, 8, 8, 8}
+
+// conn is one side of a session.
+type conn struct {
+	ctx  context.Context
+	port *serial.Port
+	opts *Options
+	// pending holds input not consumed yet.
+	pending []byte
+	rbuf    []byte
+	// crc32 selects CRC-32 for the binary headers and data subpackets sent.
+	crc32 bool
+	// escCtl escapes all control characters sent.
+	escCtl bool
+}
+
+func newConn(ctx context.Context, port *serial.Port, opts *Options) *conn {
+	if opts == nil {
+		opts = NewOptions()
+	}
+	return &conn{ctx: ctx, port: port, opts: opts, rbuf: make([]byte, 4096), escCtl: opts.EscapeControl}
+}
+
+// fill reads more input, waiting at most timeout.
+func (c *conn) fill(timeout time.Duration) error {
+	n, err := portio.Read(c.ctx, c.port, c.rbuf, timeout)
+	if err != nil {
+		return err
+	}
+	c.pending = c.rbuf[:n]
+	return nil
+}
+
+// readRaw returns the next input character.
+func (c *conn) readRaw() (byte, error) {
+	for len(c.pending) == 0 {
+		if err := c.fill(c.opts.Timeout); err != nil {
+			return 0, err
+		}
+	}
+	b := c.pending[0]
+	c.pending = c.pending[1:]
+	return b, nil
+}
+
+// readChar returns the next input character, skipping flow control characters.
+func (c *conn) readChar() (byte, error) {
+	for {
+		b, err := c.readRaw()
+		if err != nil {
+			return 0, err
+		}
+		switch b {
+		case xon, xoff, xon | 0x80, xoff | 0x80:
+			continue
+		}
+		return b, nil
+	}
+}
+
+// readEscaped returns the next unescaped character, or the terminator of a data subpacket with end set.
+func (c *conn) readEscaped() (b byte, end bool, err error) {
+	if b, err = c.readChar(); err != nil || b != ZDLE {
+		return b, false, err
+	}
+	// Five CANs in a row cancel the session, the ZDLE is the first one.
+	for cans := 1; ; {
+		if b, err = c.readChar(); err != nil {
+			return 0, false, err
+		}
+		switch {
+		case b == can:
+			if cans++; cans == 5 {
+				return 0, false, ErrCanceled
+			}
+		case b == ZCRCE || b == ZCRCG || b == ZCRCQ || b == ZCRCW:
+			return b, true, nil
+		case b == ZRUB0:
+			return 0x7F, false, nil
+		case b == ZRUB1:
+			return 0xFF, false, nil
+		case b&0x60 == 0x40:
+			return b ^ 0x40, false, nil
+		default:
+			return 0, false, errEscape
+		}
+	}
+}
+
+// readEscapedBytes reads len(data) unescaped characters.
+func (c *conn) readEscapedBytes(data []byte) error {
+	for i := range data {
+		b, end, err := c.readEscaped()
+		if err != nil {
+			return err
+		}
+		if end {
+			return errEscape
+		}
+		data[i] = b
+	}
+	return nil
+}
+
+// readHeader waits for the next header, skipping anything else.
+func (c *conn) readHeader() (header, error) {
+	pads := 0
+	cans := 0
+	for garbage := 0; garbage < maxGarbage; garbage++ {
+		b, err := c.readChar()
+		if err != nil {
+			return header{}, err
+		}
+		if b == can {
+			if cans++; cans == 5 {
+				return header{}, ErrCanceled
+			}
+		} else {
+			cans = 0
+		}
+		switch {
+		case b == ZPAD || b == ZPAD|0x80:
+			pads++
+			continue
+		case b == ZDLE && pads > 0:
+			b, err := c.readChar()
+			if err != nil {
+				return header{}, err
+			}
+			switch b {
+			case ZBIN, ZBIN32:
+				return c.readBinaryHeader(b == ZBIN32)
+			case ZHEX:
+				return c.readHexHeader()
+			}
+		}
+		pads = 0
+	}
+	return header{}, errGarbage
+}
+
+func (c *conn) readBinaryHeader(use32 bool) (header, error) {
+	n := 7
+	if use32 {
+		n = 9
+	}
+	raw := make([]byte, n)
+	if err := c.readEscapedBytes(raw); err != nil {
+		return header{}, err
+	}
+	if !bytes.Equal(checksum(nil, raw[:5], use32), raw[5:]) {
+		return header{}, errCRC
+	}
+	h := header{typ: raw[0], crc32: use32}
+	copy(h.data[:], raw[1:5])
+	return h, nil
+}
+
+func (c *conn) readHexHeader() (header, error) {
+	raw := make([]byte, 7)
+	for i := range raw {
+		var v byte
+		for j := 0; j < 2; j++ {
+			b, err := c.readChar()
+			if err != nil {
+				return header{}, err
+			}
+			d, ok := fromHex(b)
+			if !ok {
+				return header{}, errGarbage
+			}
+			v = v<<4 | d
+		}
+		raw[i] = v
+	}
+	if !bytes.Equal(checksum(nil, raw[:5], false), raw[5:]) {
+		return header{}, errCRC
+	}
+	// Consume the CR LF following the header.
+	if b, err := c.readChar(); err == nil && b&0x7F == '\r' {
+		c.readChar()
+	}
+	h := header{typ: raw[0]}
+	copy(h.data[:], raw[1:5])
+	return h, nil
+}
+
+func fromHex(c byte) (byte, bool) {
+	switch {
+	case c >= '0' && c <= '9':
+		return c - '0', true
+	case c >= 'a' && c <= 'f':
+		return c - 'a' + 10, true
+	case c >= 'A' && c <= 'F':
+		return c - 'A' + 10, true
+	}
+	return 0, false
+}
+
+// readData reads a data subpacket, returning its data and terminator.
+func (c *conn) readData(buf []byte, use32 bool) ([]byte, byte, error) {
+	buf = buf[:0]
+	for {
+		b, end, err := c.readEscaped()
+		if err != nil {
+			return nil, 0, err
+		}
+		if end {
+			n := 2
+			if use32 {
+				n = 4
+			}
+			crc := make([]byte, n)
+			if err := c.readEscapedBytes(crc); err != nil {
+				return nil, 0, err
+			}
+			if !bytes.Equal(checksum(nil, append(buf, b), use32), crc) {
+				return nil, 0, errCRC
+			}
+			return buf, b, nil
+		}
+		if len(buf) >= MaxBlockSize {
+			return nil, 0, errTooLong
+		}
+		buf = append(buf, b)
+	}
+}
+
+// escape appends b to dst, escaped as needed.
+func (c *conn) escape(dst []byte, b byte) []byte {
+	switch b {
+	case ZDLE, dle, xon, xoff, dle | 0x80, xon | 0x80, xoff | 0x80:
+		return append(dst, ZDLE, b^0x40)
+	}
+	if c.escCtl && b&0x60 == 0 {
+		return append(dst, ZDLE, b^0x40)
+	}
+	return append(dst, b)
+}
+
+func (c *conn) write(data []byte) error {
+	_, err := c.port.Write(data)
+	return err
+}
+
+const hexDigits = "0123456789abcdef"
+
+// writeHexHeader sends h as a hex header, used by receivers and for session control.
+func (c *conn) writeHexHeader(h header) error {
+	raw := append([]byte{h.typ}, h.data[:]...)
+	raw = checksum(raw, raw, false)
+	frame := []byte{ZPAD, ZPAD, ZDLE, ZHEX}
+	for _, b := range raw {
+		frame = append(frame, hexDigits[b>>4], hexDigits[b&0x0f])
+	}
+	frame = append(frame, '\r', '\n'|0x80)
+	if h.typ != ZFIN && h.typ != ZACK {
+		frame = append(frame, xon)
+	}
+	return c.write(frame)
+}
+
+// binaryHeader appends h as a binary header to dst.
+func (c *conn) binaryHeader(dst []byte, h header) []byte {
+	format := ZBIN
+	if c.crc32 {
+		format = ZBIN32
+	}
+	dst = append(dst, ZPAD, ZDLE, format)
+	raw := append([]byte{h.typ}, h.data[:]...)
+	for _, b := range checksum(raw, raw, c.crc32) {
+		dst = c.escape(dst, b)
+	}
+	return dst
+}
+
+// dataSubpacket appends data as a data subpacket ended by term to dst.
+func (c *conn) dataSubpacket(dst, data []byte, term byte) []byte {
+	for _, b := range data {
+		dst = c.escape(dst, b)
+	}
+	dst = append(dst, ZDLE, term)
+	for _, b := range checksum(nil, append(data[:len(data):len(data)], term), c.crc32) {
+		dst = c.escape(dst, b)
+	}
+	if term == ZCRCW {
+		dst = append(dst, xon)
+	}
+	return dst
+}
+
+// fail aborts the session for err, telling the remote end unless it canceled itself.
+func (c *conn) fail(err error) error {
+	if err != ErrCanceled {
+		c.write(abortSequence)
+	}
+	if ctxErr := c.ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+	return err
+}
+
+// isTimeout returns true if err is a protocol timeout.
+func isTimeout(err error) bool {
+	return errors.Is(err, serial.ErrTimeout)
+}
+
+// retryable returns true for errors caused by a lost or corrupted header or subpacket.
+func retryable(err error) bool {
+	return isTimeout(err) || err == errCRC || err == errGarbage || err == errEscape || err == errTooLong
+}
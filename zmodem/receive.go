@@ -0,0 +1,223 @@
+package zmodem
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	serial "github.com/daedaluz/goserial"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Receive receives files over port until the sender ends the session.
+//
+// For each file, accept is called with its metadata and returns where to write
+// the contents and the position to resume from, which the writer must be at.
+// Returning a non-zero position equal to a known size, or ErrSkip, skips the file.
+// It returns the files received completely.
+// If ctx is done, the session is canceled on both ends.
+func Receive(ctx context.Context, port *serial.Port, accept func(f *File) (io.Writer, int64, error), opts *Options) ([]*File, error) {
+	c := newConn(ctx, port, opts)
+	c.crc32 = true
+	var files []*File
+	buf := make([]byte, MaxBlockSize)
+	rinit := c.rinit()
+	if err := c.writeHexHeader(rinit); err != nil {
+		return nil, c.fail(err)
+	}
+	for tries := 0; ; {
+		h, err := c.readHeader()
+		if retryable(err) {
+			if tries++; tries > c.opts.Retries {
+				return files, c.fail(ErrRetries)
+			}
+			if err := c.writeHexHeader(rinit); err != nil {
+				return files, c.fail(err)
+			}
+			continue
+		}
+		if err != nil {
+			return files, c.fail(err)
+		}
+		tries = 0
+		switch h.typ {
+		case ZRQINIT:
+			err = c.writeHexHeader(rinit)
+		case ZSINIT:
+			// The attention string is not used, as the sender never needs interrupting.
+			if _, _, err = c.readData(buf, h.crc32); err == nil {
+				err = c.writeHexHeader(header{typ: ZACK})
+			} else if retryable(err) {
+				err = c.writeHexHeader(header{typ: ZNAK})
+			}
+		case ZFILE:
+			var f *File
+			var info []byte
+			if info, _, err = c.readData(buf, h.crc32); err != nil {
+				if retryable(err) {
+					err = c.writeHexHeader(header{typ: ZNAK})
+				}
+				break
+			}
+			if f, err = parseFileInfo(info); err != nil {
+				break
+			}
+			var done bool
+			if done, err = c.receiveFile(f, accept, buf); err == nil && done {
+				files = append(files, f)
+			}
+		case ZFIN:
+			if err := c.writeHexHeader(header{typ: ZFIN}); err != nil {
+				return files, c.fail(err)
+			}
+			// Consume the "OO" ending the session, if it arrives.
+			for n := 0; n < 2; n++ {
+				if len(c.pending) == 0 && c.fill(time.Second) != nil {
+					break
+				}
+				if len(c.pending) > 0 {
+					c.pending = c.pending[1:]
+				}
+			}
+			return files, nil
+		default:
+			err = c.writeHexHeader(rinit)
+		}
+		if err != nil {
+			return files, c.fail(err)
+		}
+	}
+}
+
+// rinit returns the ZRINIT header announcing the capabilities of the receiver.
+func (c *conn) rinit() header {
+	h := header{typ: ZRINIT}
+	h.data[zf0] = CANFDX | CANOVIO | CANFC32
+	if c.escCtl {
+		h.data[zf0] |= ESCCTL
+	}
+	return h
+}
+
+// parseFileInfo parses the data subpacket of ZFILE: the name, a NUL, and the
+// decimal size and octal modification time separated by spaces.
+func parseFileInfo(info []byte) (*File, error) {
+	name := info
+	var meta []byte
+	if i := bytes.IndexByte(info, 0); i >= 0 {
+		name, meta = info[:i], info[i+1:]
+	}
+	if i := bytes.IndexByte(meta, 0); i >= 0 {
+		meta = meta[:i]
+	}
+	f := &File{Name: string(name), Size: -1}
+	fields := strings.Fields(string(meta))
+	if len(fields) > 0 {
+		size, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("zmodem: invalid file size %q", fields[0])
+		}
+		f.Size = size
+	}
+	if len(fields) > 1 {
+		mtime, err := strconv.ParseInt(fields[1], 8, 64)
+		if err != nil {
+			return nil, fmt.Errorf("zmodem: invalid modification time %q", fields[1])
+		}
+		if mtime != 0 {
+			f.ModTime = time.Unix(mtime, 0)
+		}
+	}
+	return f, nil
+}
+
+// receiveFile asks accept where f goes and receives it, returning true if it was not skipped.
+func (c *conn) receiveFile(f *File, accept func(f *File) (io.Writer, int64, error), buf []byte) (bool, error) {
+	w, pos, err := accept(f)
+	if err == ErrSkip || err == nil && pos > 0 && f.Size >= 0 && pos >= f.Size {
+		return false, c.writeHexHeader(header{typ: ZSKIP})
+	}
+	if err != nil {
+		return false, err
+	}
+	if err := c.writeHexHeader(posHeader(ZRPOS, pos)); err != nil {
+		return false, err
+	}
+	errPos := pos
+	for errs := 0; ; {
+		h, err := c.readHeader()
+		if err == nil {
+			switch h.typ {
+			case ZDATA:
+				if h.pos() != pos {
+					// Data still in flight from before the last ZRPOS, wait for the sender to catch up.
+					if errs++; errs > c.opts.Retries {
+						return false, ErrRetries
+					}
+					continue
+				}
+				if pos, err = c.receiveData(f, w, pos, buf, h.crc32); err == nil {
+					errs = 0
+					continue
+				}
+			case ZEOF:
+				if h.pos() != pos {
+					continue
+				}
+				return true, c.writeHexHeader(c.rinit())
+			case ZFILE:
+				// The sender did not see the ZRPOS.
+				if _, _, err = c.readData(buf, h.crc32); err == nil {
+					err = errGarbage
+				}
+			case ZNAK:
+				err = errGarbage
+			default:
+				return false, fmt.Errorf("zmodem: unexpected frame type %d", h.typ)
+			}
+		}
+		if !retryable(err) {
+			return false, err
+		}
+		// Only count errors that make no progress, a streamed frame only ends cleanly at the end of the file.
+		if pos > errPos {
+			errs, errPos = 0, pos
+		}
+		if errs++; errs > c.opts.Retries {
+			return false, ErrRetries
+		}
+		c.pending = nil
+		if err := c.writeHexHeader(posHeader(ZRPOS, pos)); err != nil {
+			return false, err
+		}
+	}
+}
+
+// receiveData writes data subpackets to w until one ends the frame, returning the new position.
+func (c *conn) receiveData(f *File, w io.Writer, pos int64, buf []byte, use32 bool) (int64, error) {
+	for {
+		data, term, err := c.readData(buf, use32)
+		if err != nil {
+			return pos, err
+		}
+		if _, err := w.Write(data); err != nil {
+			return pos, err
+		}
+		pos += int64(len(data))
+		if c.opts.Progress != nil {
+			c.opts.Progress(f, pos)
+		}
+		switch term {
+		case ZCRCW:
+			return pos, c.writeHexHeader(posHeader(ZACK, pos))
+		case ZCRCQ:
+			if err := c.writeHexHeader(posHeader(ZACK, pos)); err != nil {
+				return pos, err
+			}
+		case ZCRCE:
+			return pos, nil
+		}
+	}
+}
@@ -0,0 +1,255 @@
+package zmodem
+
+import (
+	"context"
+	"fmt"
+	serial "github.com/daedaluz/goserial"
+	"io"
+)
+
+// Send sends files over port. The session starts with "rz\r",
+// so that a shell at the remote end starts a receiver.
+// A file skipped by the receiver is not an error.
+// If ctx is done, the session is canceled on both ends.
+func Send(ctx context.Context, port *serial.Port, files []*File, opts *Options) error {
+	c := newConn(ctx, port, opts)
+	if err := c.write([]byte("rz\r")); err != nil {
+		return c.fail(err)
+	}
+	window, err := c.startSend()
+	if err != nil {
+		return c.fail(err)
+	}
+	for _, f := range files {
+		if err := c.sendFile(f, window); err != nil {
+			return c.fail(err)
+		}
+	}
+	if err := c.finishSend(); err != nil {
+		return c.fail(err)
+	}
+	return nil
+}
+
+// startSend waits for the receiver to announce its capabilities,
+// returning its buffer size, 0 if it can receive while writing to disk.
+func (c *conn) startSend() (int, error) {
+	for tries, resend := 0, true; tries <= c.opts.Retries; {
+		if resend {
+			if err := c.writeHexHeader(header{typ: ZRQINIT}); err != nil {
+				return 0, err
+			}
+			tries++
+		}
+		h, err := c.readHeader()
+		if resend = retryable(err); resend {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		switch h.typ {
+		case ZRINIT:
+			c.crc32 = h.data[zf0]&CANFC32 != 0
+			c.escCtl = c.escCtl || h.data[zf0]&ESCCTL != 0
+			return int(h.data[0]) | int(h.data[1])<<8, nil
+		case ZCHALLENGE:
+			if err := c.writeHexHeader(header{typ: ZACK, data: h.data}); err != nil {
+				return 0, err
+			}
+		default:
+			resend = true
+		}
+	}
+	return 0, ErrRetries
+}
+
+// sendFile offers f to the receiver and sends it from the position it asks for.
+func (c *conn) sendFile(f *File, window int) error {
+	info := append([]byte(f.Name), 0)
+	if f.Size >= 0 {
+		var mtime int64
+		if !f.ModTime.IsZero() {
+			mtime = f.ModTime.Unix()
+		}
+		info = append(info, fmt.Sprintf("%d %o", f.Size, mtime)...)
+	}
+	info = append(info, 0)
+	frame := c.binaryHeader(nil, header{typ: ZFILE})
+	frame = c.dataSubpacket(frame, info, ZCRCW)
+	for tries, resend := 0, true; tries <= c.opts.Retries; {
+		if resend {
+			if err := c.write(frame); err != nil {
+				return err
+			}
+			tries++
+		}
+		h, err := c.readHeader()
+		if resend = retryable(err); resend {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		switch h.typ {
+		case ZRPOS:
+			return c.sendData(f, h.pos(), window)
+		case ZSKIP:
+			return nil
+		case ZNAK:
+			resend = true
+		}
+	}
+	return ErrRetries
+}
+
+// sendData sends f from pos until the receiver acknowledges its end,
+// going back to any position the receiver asks for.
+func (c *conn) sendData(f *File, pos int64, window int) error {
+	size := c.opts.BlockSize
+	if size <= 0 || size > MaxBlockSize {
+		size = DefaultBlockSize
+	}
+	buf := make([]byte, size)
+	last := int64(-1)
+	for errs := 0; ; {
+		// Only count restarts that make no progress.
+		if pos > last {
+			errs = 0
+		} else if errs++; errs > c.opts.Retries {
+			return ErrRetries
+		}
+		last = pos
+		if _, err := f.Reader.Seek(pos, io.SeekStart); err != nil {
+			return err
+		}
+		var err error
+		if pos, err = c.sendFrom(f, pos, buf, window); err != nil || pos < 0 {
+			return err
+		}
+	}
+}
+
+// sendFrom sends f, positioned at pos, until the end is acknowledged, returning -1,
+// or the receiver asks for another position, returning it.
+func (c *conn) sendFrom(f *File, pos int64, buf []byte, window int) (int64, error) {
+	frame := c.binaryHeader(nil, posHeader(ZDATA, pos))
+	unacked := 0
+	for {
+		if err := c.ctx.Err(); err != nil {
+			return 0, err
+		}
+		n, err := io.ReadFull(f.Reader, buf)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return 0, err
+		}
+		eof := err != nil
+		term := ZCRCG
+		if window > 0 && unacked+n >= window {
+			term = ZCRCW
+		} else if eof {
+			term = ZCRCE
+		}
+		frame = c.dataSubpacket(frame, buf[:n], term)
+		if err := c.write(frame); err != nil {
+			return 0, err
+		}
+		frame = frame[:0]
+		pos += int64(n)
+		unacked += n
+		if c.opts.Progress != nil {
+			c.opts.Progress(f, pos)
+		}
+		if term == ZCRCW {
+			h, err := c.readHeader()
+			if retryable(err) {
+				// Start over from where the receiver should be.
+				return pos, nil
+			}
+			if err != nil {
+				return 0, err
+			}
+			if h.typ == ZRPOS {
+				return h.pos(), nil
+			}
+			unacked = 0
+			if !eof {
+				frame = c.binaryHeader(frame, posHeader(ZDATA, pos))
+			}
+		} else if c.poll() {
+			h, err := c.readHeader()
+			if err != nil && !retryable(err) {
+				return 0, err
+			}
+			if err == nil && h.typ == ZRPOS {
+				return h.pos(), nil
+			}
+		}
+		if eof {
+			return c.sendEOF(pos)
+		}
+	}
+}
+
+// sendEOF announces the end of the file at pos and waits for the receiver to confirm it.
+func (c *conn) sendEOF(pos int64) (int64, error) {
+	frame := c.binaryHeader(nil, posHeader(ZEOF, pos))
+	for tries := 0; tries <= c.opts.Retries; tries++ {
+		if err := c.write(frame); err != nil {
+			return 0, err
+		}
+		h, err := c.readHeader()
+		if retryable(err) {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		switch h.typ {
+		case ZRINIT:
+			return -1, nil
+		case ZRPOS:
+			return h.pos(), nil
+		}
+	}
+	return 0, ErrRetries
+}
+
+// poll returns true if a header may be arriving, without waiting.
+// Input that cannot start a header, like the XON following hex headers, is discarded.
+func (c *conn) poll() bool {
+	for {
+		for len(c.pending) > 0 {
+			switch c.pending[0] {
+			case ZPAD, ZPAD | 0x80, can:
+				return true
+			}
+			c.pending = c.pending[1:]
+		}
+		n, err := c.port.ReadTimeout(c.rbuf, 0)
+		if err != nil || n == 0 {
+			return false
+		}
+		c.pending = c.rbuf[:n]
+	}
+}
+
+// finishSend ends the session.
+func (c *conn) finishSend() error {
+	for tries := 0; tries <= c.opts.Retries; tries++ {
+		if err := c.writeHexHeader(header{typ: ZFIN}); err != nil {
+			return err
+		}
+		h, err := c.readHeader()
+		if retryable(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if h.typ == ZFIN {
+			return c.write([]byte("OO"))
+		}
+	}
+	return ErrRetries
+}
@@ -0,0 +1,172 @@
+// Package zmodem implements the ZMODEM file transfer protocol over serial.Port,
+// compatible with the rz and sz programs of lrzsz.
+package zmodem
+
+import (
+	"errors"
+	"github.com/daedaluz/goserial/internal/crc"
+	"hash/crc32"
+	"io"
+	"time"
+)
+
+// Framing characters
+const (
+	ZPAD  = byte('*')
+	ZDLE  = byte(0x18)
+	ZDLEE = ZDLE ^ 0x40
+	// Header formats
+	ZBIN   = byte('A')
+	ZHEX   = byte('B')
+	ZBIN32 = byte('C')
+	// Data subpacket terminators
+	ZCRCE = byte('h')
+	ZCRCG = byte('i')
+	ZCRCQ = byte('j')
+	ZCRCW = byte('k')
+	ZRUB0 = byte('l')
+	ZRUB1 = byte('m')
+
+	xon  = byte(0x11)
+	xoff = byte(0x13)
+	dle  = byte(0x10)
+	can  = byte(0x18)
+)
+
+// Frame types
+const (
+	ZRQINIT = byte(iota)
+	ZRINIT
+	ZSINIT
+	ZACK
+	ZFILE
+	ZSKIP
+	ZNAK
+	ZABORT
+	ZFIN
+	ZRPOS
+	ZDATA
+	ZEOF
+	ZFERR
+	ZCRC
+	ZCHALLENGE
+	ZCOMPL
+	ZCAN
+	ZFREECNT
+	ZCOMMAND
+	ZSTDERR
+)
+
+// ZRINIT capability flags
+const (
+	CANFDX  = byte(0x01)
+	CANOVIO = byte(0x02)
+	CANBRK  = byte(0x04)
+	CANCRY  = byte(0x08)
+	CANLZW  = byte(0x10)
+	CANFC32 = byte(0x20)
+	ESCCTL  = byte(0x40)
+	ESC8    = byte(0x80)
+)
+
+// Offsets of the flag bytes in a header, position headers use the same bytes little endian.
+const (
+	zf0 = 3
+	zf1 = 2
+	zf2 = 1
+	zf3 = 0
+)
+
+var (
+	// ErrCanceled is returned when the remote end cancels the session.
+	ErrCanceled = errors.New("zmodem: session canceled by remote")
+	// ErrRetries is returned when the remote end does not respond within the retry limit.
+	ErrRetries = errors.New("zmodem: too many retries")
+	// ErrSkip is returned by the accept function of Receive to skip a file.
+	ErrSkip = errors.New("zmodem: skip file")
+
+	errCRC     = errors.New("zmodem: checksum mismatch")
+	errGarbage = errors.New("zmodem: garbage on line")
+	errEscape  = errors.New("zmodem: invalid escape sequence")
+	errTooLong = errors.New("zmodem: data subpacket too long")
+)
+
+// Protocol defaults
+const (
+	DefaultTimeout   = 10 * time.Second
+	DefaultRetries   = 10
+	DefaultBlockSize = 1024
+	// MaxBlockSize is the largest data subpacket, as used by ZMODEM-8k.
+	MaxBlockSize = 8192
+)
+
+// File describes a file of a session.
+type File struct {
+	// Name is the file name, using '/' as separator. Received names come
+	// from the remote end and must be sanitized before use as a path.
+	Name string
+	// Size in bytes, -1 if unknown.
+	Size int64
+	// ModTime is the modification time, zero if unknown.
+	ModTime time.Time
+	// Reader supplies the contents of the file when sending.
+	// It is seeked to the positions the receiver asks for, to resume or to repeat lost data.
+	Reader io.ReadSeeker
+}
+
+// Options control a session. A nil *Options uses the defaults.
+type Options struct {
+	// Timeout is how long to wait for the remote end.
+	Timeout time.Duration
+	// Retries is how many times a header is repeated, or a position
+	// requested again, before giving up.
+	Retries int
+	// BlockSize is the size of the data subpackets sent, at most MaxBlockSize.
+	BlockSize int
+	// EscapeControl escapes all control characters, for links that do not pass them.
+	EscapeControl bool
+	// Progress, if set, is called with the position in the current file
+	// after every data subpacket.
+	Progress func(f *File, pos int64)
+}
+
+// NewOptions returns Options with the defaults.
+func NewOptions() *Options {
+	return &Options{
+		Timeout:   DefaultTimeout,
+		Retries:   DefaultRetries,
+		BlockSize: DefaultBlockSize,
+	}
+}
+
+// header is a ZMODEM frame header.
+type header struct {
+	typ  byte
+	data [4]byte
+	// crc32 is set when a binary header was received with a CRC-32,
+	// in which case the following data subpackets use it too.
+	crc32 bool
+}
+
+func posHeader(typ byte, pos int64) header {
+	return header{typ: typ, data: [4]byte{byte(pos), byte(pos >> 8), byte(pos >> 16), byte(pos >> 24)}}
+}
+
+func (h header) pos() int64 {
+	return int64(h.data[0]) | int64(h.data[1])<<8 | int64(h.data[2])<<16 | int64(h.data[3])<<24
+}
+
+// CRC16 returns the CRC-16 used by ZMODEM (polynomial 0x1021, initial value 0).
+func CRC16(data []byte) uint16 {
+	return crc.CRC16(data)
+}
+
+// checksum appends the CRC-16 (big endian) or CRC-32 (little endian) of data to dst.
+func checksum(dst, data []byte, use32 bool) []byte {
+	if use32 {
+		crc := crc32.ChecksumIEEE(data)
+		return append(dst, byte(crc), byte(crc>>8), byte(crc>>16), byte(crc>>24))
+	}
+	crc := CRC16(data)
+	return append(dst, byte(crc>>8), byte(crc))
+}
@@ -0,0 +1,88 @@
+package zmodem
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/daedaluz/goserial/internal/ptytest"
+	"io"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func testOptions() *Options {
+	opts := NewOptions()
+	opts.Timeout = 2 * time.Second
+	return opts
+}
+
+// transfer sends f over a pty pair to a receiver resuming at pos
+// with the first pos bytes of the contents already in place.
+func transfer(t *testing.T, f *File, contents []byte, pos int64) ([]*File, []byte) {
+	t.Helper()
+	master, slave := ptytest.Pair(t)
+	sent := make(chan error, 1)
+	go func() {
+		sent <- Send(context.Background(), master, []*File{f}, testOptions())
+	}()
+	var out bytes.Buffer
+	out.Write(contents[:pos])
+	files, err := Receive(context.Background(), slave, func(*File) (io.Writer, int64, error) {
+		return &out, pos, nil
+	}, testOptions())
+	if err != nil {
+		t.Fatalf("Receive: %v", err)
+	}
+	if err := <-sent; err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	return files, out.Bytes()
+}
+
+func TestTransfer(t *testing.T) {
+	contents := make([]byte, 20000)
+	rand.New(rand.NewSource(1)).Read(contents)
+	f := &File{Name: "data.bin", Size: int64(len(contents)), Reader: bytes.NewReader(contents)}
+	files, out := transfer(t, f, contents, 0)
+	if len(files) != 1 || files[0].Name != "data.bin" || files[0].Size != f.Size {
+		t.Fatalf("got files %+v", files)
+	}
+	if !bytes.Equal(out, contents) {
+		t.Fatal("received contents differ")
+	}
+}
+
+func TestResume(t *testing.T) {
+	contents := make([]byte, 5000)
+	rand.New(rand.NewSource(2)).Read(contents)
+
+	// Resuming a file of unknown size transfers the rest.
+	f := &File{Name: "log.txt", Size: -1, Reader: bytes.NewReader(contents)}
+	files, out := transfer(t, f, contents, 3000)
+	if len(files) != 1 || !bytes.Equal(out, contents) {
+		t.Fatalf("unknown size: got %d files, %d of %d bytes", len(files), len(out), len(contents))
+	}
+
+	// Resuming at the known size skips the file.
+	f = &File{Name: "log.txt", Size: int64(len(contents)), Reader: bytes.NewReader(contents)}
+	files, out = transfer(t, f, contents, int64(len(contents)))
+	if len(files) != 0 || !bytes.Equal(out, contents) {
+		t.Fatalf("complete file: got %d files, %d bytes", len(files), len(out))
+	}
+}
+
+func TestReceiveHangup(t *testing.T) {
+	master, slave := ptytest.Pair(t)
+	time.AfterFunc(100*time.Millisecond, func() { master.Close() })
+	start := time.Now()
+	_, err := Receive(context.Background(), slave, func(*File) (io.Writer, int64, error) {
+		return io.Discard, 0, nil
+	}, testOptions())
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("got %v, want io.ErrUnexpectedEOF", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("returned after %v", d)
+	}
+}